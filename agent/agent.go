@@ -2,48 +2,35 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sync"
+
+	nomadapi "github.com/hashicorp/nomad/api"
 )
 
 // Agent represents the main event collection agent
 type Agent struct {
-	config   *Config
-	managers []EventManager
-	sinks    []Sink
-	ctx      context.Context
-	cancel   context.CancelFunc
-	wg       sync.WaitGroup
-	mu       sync.Mutex
-	logger   *slog.Logger
+	config       *Config
+	managers     []EventManager
+	sinks        []Sink
+	checkpoints  CheckpointStore
+	elector      *LeaderElector
+	eventTypes   []string
+	changeFields map[string][]string
+	ctx          context.Context
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+	mu           sync.Mutex
+	logger       *slog.Logger
+
+	closeSinksOnce sync.Once
 }
 
 // New creates a new agent with the given configuration
 func New(config *Config) (*Agent, error) {
-	// Create sinks based on configuration
-	var sinks []Sink
-
-	for _, sinkType := range config.Sinks {
-		var sink Sink
-		var err error
-
-		switch sinkType {
-		case "stdout":
-			sink = NewStdoutSink()
-		case "file":
-			sink, err = NewFileSink(config.FileConfig.Path)
-		default:
-			return nil, fmt.Errorf("unknown sink type: %s", sinkType)
-		}
-
-		if err != nil {
-			return nil, fmt.Errorf("failed to create %s sink: %w", sinkType, err)
-		}
-
-		sinks = append(sinks, sink)
-	}
-
 	// Determine which event types to monitor
 	eventTypes := config.EventTypes
 	if len(eventTypes) == 0 {
@@ -58,27 +45,121 @@ func New(config *Config) (*Agent, error) {
 		}
 	}
 
-	// Create event managers for specified event types
+	// Create sinks based on configuration
+	sinks, err := createSinks(config, eventTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	changeFields, err := ParseChangeFields(config.ChangeFields)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoints, err := createCheckpointStore(config.CheckpointConfig, config.ClusterConfigs()[0])
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	a := &Agent{
+		config:       config,
+		sinks:        sinks,
+		checkpoints:  checkpoints,
+		eventTypes:   eventTypes,
+		changeFields: changeFields,
+		ctx:          ctx,
+		cancel:       cancel,
+		logger:       GetLogger(),
+	}
+
+	// Create the managers up front so configuration errors surface
+	// immediately, even in high-availability mode where every leadership
+	// term runs a fresh set of managers
+	a.managers, err = a.createClusterManagers()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if config.HAConfig.Enabled {
+		a.elector, err = NewLeaderElector(config.ClusterConfigs()[0], config.HAConfig)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to create leader elector: %w", err)
+		}
+	}
+
+	return a, nil
+}
+
+// createClusterManagers creates a full set of event managers for every cluster
+func (a *Agent) createClusterManagers() ([]EventManager, error) {
+	var managers []EventManager
+
+	for _, cluster := range a.config.ClusterConfigs() {
+		managerConfig := ManagerConfig{
+			Cluster:      cluster,
+			Sinks:        a.sinks,
+			RateLimit:    a.config.RateLimit,
+			ChangeFields: a.changeFields,
+			Namespaces:   a.config.Namespaces,
+			Checkpoints:  a.checkpoints,
+			InitialState: a.config.InitialState,
+		}
+
+		clusterManagers, err := createManagers(managerConfig, a.eventTypes, a.config.StreamConfig)
+		if err != nil {
+			if cluster.Label != "" {
+				return nil, fmt.Errorf("cluster %s: %w", cluster.Label, err)
+			}
+			return nil, err
+		}
+
+		managers = append(managers, clusterManagers...)
+	}
+
+	return managers, nil
+}
+
+// createManagers creates event managers for the specified event types
+func createManagers(managerConfig ManagerConfig, eventTypes []string, streamConfig StreamConfig) ([]EventManager, error) {
 	var managers []EventManager
 
+	allocationManagerCreated := false
+
 	for _, eventType := range eventTypes {
 		var manager EventManager
 		var err error
 
 		switch eventType {
-		case EventTypeAllocation:
-			manager, err = NewAllocationManager(config.NomadAddr, config.NomadToken, sinks, config.RateLimit)
+		case EventTypeAllocation, EventTypeTask:
+			// Allocation and task events are both handled by a single
+			// AllocationManager so allocations are only polled once
+			if allocationManagerCreated {
+				continue
+			}
+			allocationManagerCreated = true
+
+			manager, err = NewAllocationManager(managerConfig,
+				slices.Contains(eventTypes, EventTypeAllocation),
+				slices.Contains(eventTypes, EventTypeTask),
+			)
 		case EventTypeEvaluation:
-			manager, err = NewEvaluationManager(config.NomadAddr, config.NomadToken, sinks)
+			manager, err = NewEvaluationManager(managerConfig)
 		case EventTypeNode:
-			manager, err = NewNodeManager(config.NomadAddr, config.NomadToken, sinks)
+			manager, err = NewNodeManager(managerConfig)
 		case EventTypeJob:
-			manager, err = NewJobManager(config.NomadAddr, config.NomadToken, sinks)
+			manager, err = NewJobManager(managerConfig)
 		case EventTypeDeployment:
-			manager, err = NewDeploymentManager(config.NomadAddr, config.NomadToken, sinks)
-		case EventTypeTask:
-			// Task events are handled by the AllocationManager
-			manager, err = NewAllocationManager(config.NomadAddr, config.NomadToken, sinks, config.RateLimit)
+			manager, err = NewDeploymentManager(managerConfig)
+		case EventTypeStream:
+			var topics map[nomadapi.Topic][]string
+			topics, err = ParseStreamTopics(streamConfig.Topics)
+			if err == nil {
+				manager, err = NewStreamManager(managerConfig, topics, streamConfig.Index)
+			}
 		default:
 			return nil, fmt.Errorf("unknown event type: %s", eventType)
 		}
@@ -90,20 +171,34 @@ func New(config *Config) (*Agent, error) {
 		managers = append(managers, manager)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	return managers, nil
+}
 
-	return &Agent{
-		config:   config,
-		managers: managers,
-		sinks:    sinks,
-		ctx:      ctx,
-		cancel:   cancel,
-		logger:   GetLogger(),
-	}, nil
+// createCheckpointStore creates the checkpoint store based on configuration,
+// returning nil when checkpointing is disabled
+func createCheckpointStore(config CheckpointConfig, cluster ClusterConfig) (CheckpointStore, error) {
+	switch config.Store {
+	case "", "none":
+		return nil, nil
+	case "file":
+		store, err := NewFileCheckpointStore(config.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file checkpoint store: %w", err)
+		}
+		return store, nil
+	case "nomad":
+		store, err := NewVariablesCheckpointStore(cluster, config.VariablePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create nomad checkpoint store: %w", err)
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown checkpoint store: %s", config.Store)
+	}
 }
 
 // createSinks creates sink instances based on configuration
-func createSinks(config *Config) ([]Sink, error) {
+func createSinks(config *Config, eventTypes []string) ([]Sink, error) {
 	var sinks []Sink
 
 	for _, sinkType := range config.Sinks {
@@ -111,48 +206,222 @@ func createSinks(config *Config) ([]Sink, error) {
 		case "stdout":
 			sinks = append(sinks, NewStdoutSink())
 		case "file":
-			fileSink, err := NewFileSink(config.FileConfig.Path)
+			fileSink, err := NewFileSink(config.FileConfig)
 			if err != nil {
 				return nil, fmt.Errorf("failed to create file sink: %w", err)
 			}
 			sinks = append(sinks, fileSink)
+		case "webhook":
+			webhookSink, err := NewWebhookSink(config.WebhookConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create webhook sink: %w", err)
+			}
+			sinks = append(sinks, webhookSink)
+		case "kafka":
+			kafkaSink, err := NewKafkaSink(config.KafkaConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create kafka sink: %w", err)
+			}
+			sinks = append(sinks, kafkaSink)
+		case "syslog":
+			syslogSink, err := NewSyslogSink(config.SyslogConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create syslog sink: %w", err)
+			}
+			sinks = append(sinks, syslogSink)
+		case "elasticsearch":
+			elasticsearchSink, err := NewElasticsearchSink(config.ElasticsearchConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create elasticsearch sink: %w", err)
+			}
+			sinks = append(sinks, elasticsearchSink)
+		case "loki":
+			lokiSink, err := NewLokiSink(config.LokiConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create loki sink: %w", err)
+			}
+			sinks = append(sinks, lokiSink)
+		case "splunk_hec":
+			splunkSink, err := NewSplunkHECSink(config.SplunkHECConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create splunk_hec sink: %w", err)
+			}
+			sinks = append(sinks, splunkSink)
+		case "s3":
+			s3Sink, err := NewS3Sink(config.S3Config)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create s3 sink: %w", err)
+			}
+			sinks = append(sinks, s3Sink)
+		case "sql":
+			sqlSink, err := NewSQLSink(config.SQLConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create sql sink: %w", err)
+			}
+			sinks = append(sinks, sqlSink)
+		case "redis":
+			redisSink, err := NewRedisSink(config.RedisConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create redis sink: %w", err)
+			}
+			sinks = append(sinks, redisSink)
+		case "amqp":
+			amqpSink, err := NewAMQPSink(config.AMQPConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create amqp sink: %w", err)
+			}
+			sinks = append(sinks, amqpSink)
+		case "otlp":
+			otlpSink, err := NewOTLPSink(config.OTLPConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create otlp sink: %w", err)
+			}
+			sinks = append(sinks, otlpSink)
+		case "chat":
+			chatSink, err := NewChatSink(config.ChatConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create chat sink: %w", err)
+			}
+			sinks = append(sinks, chatSink)
+		case "incident":
+			incidentSink, err := NewIncidentSink(config.IncidentConfig)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create incident sink: %w", err)
+			}
+			sinks = append(sinks, incidentSink)
 		default:
 			return nil, fmt.Errorf("unknown sink type: %s", sinkType)
 		}
 	}
 
+	// The metrics endpoint is fed like any other sink
+	if config.MetricsConfig.Enabled {
+		metricsSink, err := NewMetricsSink(config.MetricsConfig, slices.Contains(eventTypes, EventTypeNode))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create metrics endpoint: %w", err)
+		}
+		sinks = append(sinks, metricsSink)
+	}
+
 	return sinks, nil
 }
 
-// Start starts the agent and all event managers
+// Start starts the agent and all event managers. In high-availability mode
+// the managers only run while this instance holds leadership.
 func (a *Agent) Start() error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
 	a.logger.Info("Starting Nomad event collection agent")
 
-	// Start all event managers
-	for _, manager := range a.managers {
-		a.wg.Add(1)
-		go func(m EventManager) {
+	a.wg.Add(1)
+	if a.elector != nil {
+		go func() {
 			defer a.wg.Done()
-			if err := m.Start(a.ctx); err != nil {
-				a.logger.Error("Manager failed to start",
-					"event_type", m.GetEventType(),
-					"error", err.Error(),
-				)
-			}
-		}(manager)
+			a.elector.Run(a.ctx, a.lead)
+		}()
+	} else {
+		go func() {
+			defer a.wg.Done()
+			a.runManagers(a.ctx, a.managers)
+		}()
 	}
 
 	a.logger.Info("Agent started successfully",
 		"event_manager_count", len(a.managers),
+		"cluster_count", len(a.config.ClusterConfigs()),
+		"high_availability", a.elector != nil,
 		"rate_limit_seconds", a.config.RateLimit.Seconds(),
 		"sinks", len(a.sinks),
 	)
 	return nil
 }
 
+// lead runs a fresh set of managers for as long as this instance is the
+// leader, resuming from the shared checkpoints
+func (a *Agent) lead(ctx context.Context) error {
+	managers, err := a.createClusterManagers()
+	if err != nil {
+		return err
+	}
+
+	a.runManagers(ctx, managers)
+	return nil
+}
+
+// runManagers starts the managers and stops them once the context is cancelled
+func (a *Agent) runManagers(ctx context.Context, managers []EventManager) {
+	// Node gauges start from the current nodes, as node events only report
+	// changes. A new leader seeds them again, they went stale on standby.
+	for _, sink := range a.sinks {
+		if metricsSink, ok := sink.(*MetricsSink); ok {
+			if err := metricsSink.SeedNodes(ctx, a.config.ClusterConfigs()); err != nil {
+				a.logger.Error("Failed to seed node metrics",
+					"error", err.Error(),
+				)
+			}
+		}
+	}
+
+	for _, manager := range managers {
+		if err := manager.Start(ctx); err != nil {
+			a.logger.Error("Manager failed to start",
+				"event_type", manager.GetEventType(),
+				"error", err.Error(),
+			)
+		}
+	}
+
+	<-ctx.Done()
+
+	for _, manager := range managers {
+		if err := manager.Stop(); err != nil {
+			a.logger.Error("Manager failed to stop",
+				"event_type", manager.GetEventType(),
+				"error", err.Error(),
+			)
+		}
+	}
+
+	// On shutdown the sinks flush their queues before the held-back
+	// checkpoints are saved. In high-availability mode this runs at the end
+	// of every leadership term, before the lock is released.
+	if a.ctx.Err() != nil {
+		a.closeSinks()
+	}
+	for _, manager := range managers {
+		manager.FlushCheckpoint()
+	}
+}
+
+// closeSinks closes every sink once
+func (a *Agent) closeSinks() {
+	a.closeSinksOnce.Do(func() {
+		for _, sink := range a.sinks {
+			if err := sink.Close(); err != nil {
+				a.logger.Error("Failed to close sink",
+					"error", err.Error(),
+				)
+			}
+		}
+	})
+}
+
+// Reopen reopens the files of every sink writing to local files, after an
+// external tool such as logrotate moved them
+func (a *Agent) Reopen() error {
+	var errs []error
+	for _, sink := range a.sinks {
+		if reopener, ok := sink.(Reopener); ok {
+			if err := reopener.Reopen(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 // Stop stops the agent and all event managers
 func (a *Agent) Stop() error {
 	a.mu.Lock()
@@ -166,10 +435,13 @@ func (a *Agent) Stop() error {
 	// Wait for all managers to stop
 	a.wg.Wait()
 
-	// Close all sinks
-	for _, sink := range a.sinks {
-		if err := sink.Close(); err != nil {
-			a.logger.Error("Failed to close sink",
+	// A standby that never led still has to close the sinks
+	a.closeSinks()
+
+	// Close the checkpoint store
+	if a.checkpoints != nil {
+		if err := a.checkpoints.Close(); err != nil {
+			a.logger.Error("Failed to close checkpoint store",
 				"error", err.Error(),
 			)
 		}
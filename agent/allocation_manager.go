@@ -3,28 +3,53 @@ package agent
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"slices"
+	"sync"
 	"time"
 
 	nomadapi "github.com/hashicorp/nomad/api"
 )
 
-// AllocationManager manages allocation events
+// AllocationManager manages allocation and task events
 type AllocationManager struct {
 	*BaseManager
-	lastSeenTime int64
+	lastSeenTime     int64
+	emitAllocations  bool
+	emitTasks        bool
+	allocationStates map[string]trackedAllocation
 }
 
-func NewAllocationManager(nomadAddr, nomadToken string, sinks []Sink, rateLimit time.Duration) (*AllocationManager, error) {
-	baseManager, err := NewBaseManager(nomadAddr, nomadToken, sinks, EventTypeAllocation, rateLimit)
+// trackedAllocation is the last known lifecycle state of an allocation
+type trackedAllocation struct {
+	modifyIndex uint64
+	state       *AllocationState
+
+	// transitionRead is whether the desired transition in state was read
+	// from the allocation rather than assumed empty
+	transitionRead bool
+}
+
+func NewAllocationManager(config ManagerConfig, emitAllocations, emitTasks bool) (*AllocationManager, error) {
+	baseManager, err := NewBaseManager(config, EventTypeAllocation, config.RateLimit)
 	if err != nil {
 		return nil, err
 	}
 	return &AllocationManager{
-		BaseManager: baseManager,
+		BaseManager:      baseManager,
+		emitAllocations:  emitAllocations,
+		emitTasks:        emitTasks,
+		allocationStates: make(map[string]trackedAllocation),
 	}, nil
 }
 
 func (m *AllocationManager) Start(ctx context.Context) error {
+	checkpoint := m.restoreCheckpoint()
+	if checkpoint != nil {
+		m.lastSeenTime = checkpoint.LastSeenTime
+	}
+	m.prepareFirstRun(checkpoint)
+
 	m.wg.Add(1)
 	go func() {
 		defer m.wg.Done()
@@ -48,44 +73,64 @@ func (m *AllocationManager) watchAllocations(ctx context.Context) error {
 	}
 
 	// Get allocations with blocking query
-	allocations, meta, err := m.nomadClient.Allocations().List(opts)
+	allocations, meta, err := m.nomadClient.Allocations().List(opts.WithContext(ctx))
 	if err != nil {
 		return fmt.Errorf("failed to get allocations: %w", err)
 	}
 
+	// Remember the index of the previous poll to find allocations that
+	// changed since then
+	previousIndex := m.lastIndex
+
 	// Update last index
 	if meta != nil && meta.LastIndex > m.lastIndex {
 		m.lastIndex = meta.LastIndex
 	}
 
-	// Track the maximum task event time across all allocations in this query
-	maxEventTime := m.lastSeenTime
+	// Skip allocations outside of the watched namespaces
+	allocations = slices.DeleteFunc(allocations, func(alloc *nomadapi.AllocationListStub) bool {
+		return !m.watchesNamespace(alloc.Namespace)
+	})
 
-	// Process allocations for task events
-	for _, allocStub := range allocations {
-		allocationMaxTime, err := m.processAllocationTaskEvents(allocStub)
-		if err != nil {
-			m.logger.Error("Failed to process allocation task events",
-				"allocation_id", allocStub.ID,
-				"error", err.Error(),
-				"job_id", allocStub.JobID,
-			)
-		}
+	if m.emitAllocations {
+		m.processAllocationTransitions(ctx, allocations, previousIndex)
+	}
+
+	if m.emitTasks {
+		// Track the maximum task event time across all allocations in this query
+		maxEventTime := m.lastSeenTime
+
+		// Process allocations for task events
+		for _, allocStub := range allocations {
+			allocationMaxTime, err := m.processAllocationTaskEvents(allocStub)
+			if err != nil {
+				m.logger.Error("Failed to process allocation task events",
+					"allocation_id", allocStub.ID,
+					"error", err.Error(),
+					"job_id", allocStub.JobID,
+				)
+			}
 
-		// Update max event time if this allocation had newer events
-		if allocationMaxTime > maxEventTime {
-			maxEventTime = allocationMaxTime
+			// Update max event time if this allocation had newer events
+			if allocationMaxTime > maxEventTime {
+				maxEventTime = allocationMaxTime
+			}
 		}
-	}
 
-	// Update the global last seen time to the maximum found in this query
-	if maxEventTime > m.lastSeenTime {
-		m.lastSeenTime = maxEventTime
+		// Update the global last seen time to the maximum found in this query
+		if maxEventTime > m.lastSeenTime {
+			m.lastSeenTime = maxEventTime
+		}
 	}
 
 	// Mark first run as complete after processing
 	m.markFirstRunComplete()
 
+	m.saveCheckpoint(Checkpoint{
+		Index:        m.lastIndex,
+		LastSeenTime: m.lastSeenTime,
+	})
+
 	return nil
 }
 
@@ -101,6 +146,12 @@ func (m *AllocationManager) processAllocationTaskEvents(alloc *nomadapi.Allocati
 			continue
 		}
 
+		// Emit the most recent event of every task on the first poll when requested
+		if m.snapshotPending() && len(taskState.Events) > 0 {
+			latest := taskState.Events[len(taskState.Events)-1]
+			m.writeSnapshotEvent(EventTypeTask, NewTaskEvent(alloc, taskName, latest, taskStateInfo(taskState)))
+		}
+
 		// Process unseen task events
 		for _, event := range taskState.Events {
 			// Convert Unix timestamp to time.Time
@@ -121,17 +172,8 @@ func (m *AllocationManager) processAllocationTaskEvents(alloc *nomadapi.Allocati
 				continue
 			}
 
-			taskStateMap := map[string]any{
-				"State":       taskState.State,
-				"Failed":      taskState.Failed,
-				"Restarts":    taskState.Restarts,
-				"LastRestart": taskState.LastRestart,
-				"StartedAt":   taskState.StartedAt,
-				"FinishedAt":  taskState.FinishedAt,
-			}
-
 			// Create task event
-			taskEvent := NewTaskEvent(alloc, taskName, event, taskStateMap)
+			taskEvent := NewTaskEvent(alloc, taskName, event, taskStateInfo(taskState))
 			nomadEvent := NewEvent(EventTypeTask, taskEvent)
 
 			// Write event
@@ -148,3 +190,167 @@ func (m *AllocationManager) processAllocationTaskEvents(alloc *nomadapi.Allocati
 
 	return maxEventTime, nil
 }
+
+// taskStateInfo summarizes a task state for task events
+func taskStateInfo(taskState *nomadapi.TaskState) map[string]any {
+	return map[string]any{
+		"State":       taskState.State,
+		"Failed":      taskState.Failed,
+		"Restarts":    taskState.Restarts,
+		"LastRestart": taskState.LastRestart,
+		"StartedAt":   taskState.StartedAt,
+		"FinishedAt":  taskState.FinishedAt,
+	}
+}
+
+// processAllocationTransitions compares each allocation's lifecycle state with
+// the state seen on the previous poll and emits an event for every transition
+func (m *AllocationManager) processAllocationTransitions(ctx context.Context, allocations []*nomadapi.AllocationListStub, previousIndex uint64) {
+	states := make(map[string]trackedAllocation, len(allocations))
+	transitions := m.allocationDesiredTransitions(ctx, allocations, previousIndex)
+
+	for _, alloc := range allocations {
+		tracked, known := m.allocationStates[alloc.ID]
+
+		// Allocations that have not been modified keep their previous state
+		if known && alloc.ModifyIndex <= tracked.modifyIndex {
+			states[alloc.ID] = tracked
+			continue
+		}
+
+		// Allocations whose transition was not fetched keep the last known one
+		transition, fetched := transitions[alloc.ID]
+		if !fetched && known {
+			transition = tracked.state.DesiredTransition
+		}
+
+		current := NewAllocationState(alloc, transition)
+		states[alloc.ID] = trackedAllocation{
+			modifyIndex:    alloc.ModifyIndex,
+			state:          current,
+			transitionRead: fetched || (known && tracked.transitionRead),
+		}
+
+		// Emit the current state on the first poll when requested
+		if m.snapshotPending() {
+			m.writeSnapshotEvent(EventTypeAllocation, NewAllocationEvent(alloc, nil, current))
+		}
+
+		// Skip event output on first run, only track state
+		if m.isFirstRun() {
+			continue
+		}
+
+		var previous *AllocationState
+		if known {
+			previous = tracked.state
+
+			// A transition that was never read is not known to have changed
+			if !tracked.transitionRead {
+				baseline := *previous
+				baseline.DesiredTransition = current.DesiredTransition
+				previous = &baseline
+			}
+
+			if reflect.DeepEqual(previous, current) {
+				continue
+			}
+		} else if alloc.ModifyIndex <= previousIndex {
+			// Unknown allocations that have not changed since the previous
+			// poll were already reported before resuming from a checkpoint
+			continue
+		}
+
+		nomadEvent := NewEvent(EventTypeAllocation, NewAllocationEvent(alloc, previous, current))
+		if err := m.WriteEvent(nomadEvent); err != nil {
+			m.logger.Error("Failed to write allocation event",
+				"allocation_id", alloc.ID,
+				"job_id", alloc.JobID,
+				"error", err.Error(),
+			)
+		}
+	}
+
+	// Allocations missing from the response have been garbage collected
+	m.allocationStates = states
+}
+
+// maxAllocationInfoRequests caps the allocation reads running at once while
+// fetching desired transitions
+const maxAllocationInfoRequests = 8
+
+// allocationDesiredTransitions fetches the desired transition of the
+// allocations whose transition may have changed, which the list stub does not
+// carry. Only modified allocations the server still wants running are read,
+// as the transitions of stopped or evicted allocations are no longer acted
+// on. New allocations are read when their state is written, so it carries
+// their transition, but not when they are only tracked as a baseline.
+// Allocations that could not be read are missing from the result.
+func (m *AllocationManager) allocationDesiredTransitions(ctx context.Context, allocations []*nomadapi.AllocationListStub, previousIndex uint64) map[string]nomadapi.DesiredTransition {
+	var pending []*nomadapi.AllocationListStub
+	for _, alloc := range allocations {
+		if alloc.DesiredStatus != nomadapi.AllocDesiredStatusRun {
+			continue
+		}
+
+		tracked, known := m.allocationStates[alloc.ID]
+		if known && alloc.ModifyIndex <= tracked.modifyIndex {
+			continue
+		}
+
+		// New allocations on the first poll, or unchanged since the poll
+		// before resuming, are only a baseline unless a snapshot is written
+		if !known && !m.snapshotPending() && (m.isFirstRun() || alloc.ModifyIndex <= previousIndex) {
+			continue
+		}
+
+		pending = append(pending, alloc)
+	}
+
+	transitions := make(map[string]nomadapi.DesiredTransition, len(pending))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxAllocationInfoRequests)
+
+	for _, alloc := range pending {
+		// Shutdown does not wait for the remaining reads
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(alloc *nomadapi.AllocationListStub) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			allocation, _, err := m.nomadClient.Allocations().Info(alloc.ID, (&nomadapi.QueryOptions{
+				AllowStale: true,
+				Namespace:  alloc.Namespace,
+			}).WithContext(ctx))
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				m.logger.Error("Failed to get allocation desired transition",
+					"allocation_id", alloc.ID,
+					"job_id", alloc.JobID,
+					"error", err.Error(),
+				)
+				return
+			}
+
+			mu.Lock()
+			transitions[alloc.ID] = allocation.DesiredTransition
+			mu.Unlock()
+		}(alloc)
+	}
+	wg.Wait()
+
+	return transitions
+}
@@ -0,0 +1,247 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// DefaultAMQPRoutingKey routes events by type, namespace and job so
+	// consumers can bind to patterns such as nomad.deployment.#
+	DefaultAMQPRoutingKey = "nomad.{type}.{namespace}.{job}"
+
+	// DefaultAMQPExchangeType is the type of the exchange declared by the sink
+	DefaultAMQPExchangeType = "topic"
+)
+
+// amqpExchangeTypes are the exchange types the sink can declare
+var amqpExchangeTypes = map[string]bool{
+	"direct":  true,
+	"fanout":  true,
+	"topic":   true,
+	"headers": true,
+}
+
+// AMQPSink publishes events to an AMQP 0.9.1 exchange, waiting for a
+// publisher confirm for every message. Messages are published in the
+// background, so a slow broker does not hold up the event managers.
+type AMQPSink struct {
+	config    AMQPConfig
+	tlsConfig *tls.Config
+	conn      *amqp.Connection
+	channel   *amqp.Channel
+	closed    chan *amqp.Error
+	batcher   *eventBatcher
+	mu        sync.Mutex
+	logger    *slog.Logger
+}
+
+func NewAMQPSink(config AMQPConfig) (*AMQPSink, error) {
+	uri, err := url.Parse(config.URL)
+	if err != nil || (uri.Scheme != "amqp" && uri.Scheme != "amqps") {
+		return nil, fmt.Errorf("invalid amqp url %q", config.URL)
+	}
+
+	if config.Exchange == "" {
+		return nil, fmt.Errorf("amqp exchange is required")
+	}
+
+	if config.ExchangeType == "" {
+		config.ExchangeType = DefaultAMQPExchangeType
+	}
+
+	if config.RoutingKey == "" {
+		config.RoutingKey = DefaultAMQPRoutingKey
+	}
+
+	if config.ConfirmTimeout <= 0 {
+		config.ConfirmTimeout = 30 * time.Second
+	}
+
+	// amqps URLs always connect over TLS
+	tlsConfig := config.TLS
+	if uri.Scheme == "amqps" {
+		tlsConfig.Enabled = true
+	}
+
+	s := &AMQPSink{
+		config: config,
+		logger: GetLogger(),
+	}
+
+	if s.tlsConfig, err = newClientTLSConfig(tlsConfig); err != nil {
+		return nil, err
+	}
+
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+
+	s.batcher = newEventBatcher("amqp", BatchConfig{Size: 1}, s.send)
+
+	return s, nil
+}
+
+// connect opens a connection and a channel in confirm mode, declaring the
+// exchange when configured to
+func (s *AMQPSink) connect() error {
+	conn, err := amqp.DialConfig(s.config.URL, amqp.Config{
+		TLSClientConfig: s.tlsConfig,
+		Dial:            amqp.DefaultDial(30 * time.Second),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to connect to amqp broker: %w", err)
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open amqp channel: %w", err)
+	}
+
+	if err := channel.Confirm(false); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+
+	if s.config.DeclareExchange {
+		err := channel.ExchangeDeclare(s.config.Exchange, s.config.ExchangeType, true, false, false, false, nil)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("failed to declare amqp exchange %s: %w", s.config.Exchange, err)
+		}
+	}
+
+	s.conn = conn
+	s.channel = channel
+	s.closed = channel.NotifyClose(make(chan *amqp.Error, 1))
+
+	return nil
+}
+
+// reset closes the current connection so the next publish reconnects
+func (s *AMQPSink) reset() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn = nil
+	s.channel = nil
+	s.closed = nil
+}
+
+// ensureChannel reconnects when the channel was closed by the broker or a
+// previous publish failed
+func (s *AMQPSink) ensureChannel() error {
+	if s.channel != nil {
+		select {
+		case err := <-s.closed:
+			s.logger.Error("AMQP channel closed, reconnecting",
+				"error", fmt.Sprint(err),
+			)
+			s.reset()
+		default:
+			return nil
+		}
+	}
+
+	return s.connect()
+}
+
+func (s *AMQPSink) Write(event *Event) error {
+	return s.batcher.Add(event)
+}
+
+func (s *AMQPSink) Accepted() uint64 {
+	return s.batcher.Accepted()
+}
+
+func (s *AMQPSink) Delivered() uint64 {
+	return s.batcher.Delivered()
+}
+
+// send publishes the events in order, retrying transient failures. Events
+// that still fail stay queued in the batcher and are published again with
+// the next flush.
+func (s *AMQPSink) send(events []*Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range events {
+		data, err := event.ToJSON()
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+
+		routingKey := ExpandEventTemplate(s.config.RoutingKey, event)
+
+		err = withRetry(s.config.Retry, func() error {
+			return s.publish(routingKey, amqp.Publishing{
+				ContentType:  "application/json",
+				DeliveryMode: amqp.Persistent,
+				Timestamp:    event.Time,
+				Type:         event.Type,
+				Body:         data,
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// publish sends a message and waits for the broker to confirm it
+func (s *AMQPSink) publish(routingKey string, msg amqp.Publishing) error {
+	if err := s.ensureChannel(); err != nil {
+		return retryable(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ConfirmTimeout)
+	defer cancel()
+
+	confirm, err := s.channel.PublishWithDeferredConfirmWithContext(ctx, s.config.Exchange, routingKey, false, false, msg)
+	if err != nil {
+		s.reset()
+		return retryable(fmt.Errorf("failed to publish to amqp exchange %s: %w", s.config.Exchange, err))
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		// The channel state is unknown without the confirm, start over
+		s.reset()
+		return retryable(fmt.Errorf("timed out waiting for amqp publisher confirm: %w", err))
+	}
+
+	if !acked {
+		return retryable(fmt.Errorf("amqp broker rejected message for exchange %s", s.config.Exchange))
+	}
+
+	return nil
+}
+
+func (s *AMQPSink) Close() error {
+	err := s.batcher.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return err
+	}
+
+	if closeErr := s.conn.Close(); err == nil {
+		err = closeErr
+	}
+	s.conn = nil
+	s.channel = nil
+	s.closed = nil
+	return err
+}
@@ -0,0 +1,299 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// amqpMessage is a message received by the fake broker
+type amqpMessage struct {
+	exchange     string
+	routingKey   string
+	contentType  string
+	deliveryMode byte
+	body         []byte
+}
+
+// fakeAMQPBroker speaks just enough AMQP 0.9.1 to accept publishes in
+// confirm mode. It acks every message unless nack is set and drops each
+// connection after dropAfter messages when set.
+type fakeAMQPBroker struct {
+	listener  net.Listener
+	nack      bool
+	dropAfter int
+
+	mu       sync.Mutex
+	messages []amqpMessage
+	declared []string
+}
+
+func newFakeAMQPBroker(t *testing.T) *fakeAMQPBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	b := &fakeAMQPBroker{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *fakeAMQPBroker) URL() string {
+	return "amqp://guest:guest@" + b.listener.Addr().String() + "/"
+}
+
+func (b *fakeAMQPBroker) Messages() []amqpMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]amqpMessage(nil), b.messages...)
+}
+
+func (b *fakeAMQPBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	if _, err := io.ReadFull(r, make([]byte, 8)); err != nil {
+		return
+	}
+
+	// connection.start with empty server properties
+	b.writeMethod(conn, 0, 10, 10, []byte{0, 9}, amqpTable(), amqpLongString("PLAIN"), amqpLongString("en_US"))
+
+	var (
+		publish   amqpMessage
+		remaining uint64
+		tag       uint64
+		published int
+	)
+	for {
+		frameType, channel, payload, err := readAMQPFrame(r)
+		if err != nil {
+			return
+		}
+
+		switch frameType {
+		case 1:
+			class := binary.BigEndian.Uint16(payload[0:2])
+			method := binary.BigEndian.Uint16(payload[2:4])
+			args := payload[4:]
+
+			switch {
+			case class == 10 && method == 11: // connection.start-ok
+				b.writeMethod(conn, 0, 10, 30, amqpUint16(0), amqpUint32(131072), amqpUint16(0))
+			case class == 10 && method == 40: // connection.open
+				b.writeMethod(conn, 0, 10, 41, []byte{0})
+			case class == 10 && method == 50: // connection.close
+				b.writeMethod(conn, 0, 10, 51)
+				return
+			case class == 20 && method == 10: // channel.open
+				b.writeMethod(conn, channel, 20, 11, amqpUint32(0))
+			case class == 85 && method == 10: // confirm.select
+				b.writeMethod(conn, channel, 85, 11)
+			case class == 40 && method == 10: // exchange.declare
+				name, _ := readAMQPShortString(args[2:])
+				b.mu.Lock()
+				b.declared = append(b.declared, name)
+				b.mu.Unlock()
+				b.writeMethod(conn, channel, 40, 11)
+			case class == 60 && method == 40: // basic.publish
+				exchange, rest := readAMQPShortString(args[2:])
+				routingKey, _ := readAMQPShortString(rest)
+				publish = amqpMessage{exchange: exchange, routingKey: routingKey}
+			}
+		case 2:
+			remaining = binary.BigEndian.Uint64(payload[4:12])
+			flags := binary.BigEndian.Uint16(payload[12:14])
+			props := payload[14:]
+			if flags&0x8000 != 0 {
+				publish.contentType, props = readAMQPShortString(props)
+			}
+			if flags&0x1000 != 0 {
+				publish.deliveryMode = props[0]
+			}
+		case 3:
+			publish.body = append(publish.body, payload...)
+			remaining -= uint64(len(payload))
+			if remaining > 0 {
+				continue
+			}
+
+			tag++
+			published++
+			b.mu.Lock()
+			b.messages = append(b.messages, publish)
+			b.mu.Unlock()
+
+			if b.nack {
+				b.writeMethod(conn, channel, 60, 120, amqpUint64(tag), []byte{0})
+			} else {
+				b.writeMethod(conn, channel, 60, 80, amqpUint64(tag), []byte{0})
+			}
+
+			if b.dropAfter > 0 && published >= b.dropAfter {
+				return
+			}
+		}
+	}
+}
+
+func (b *fakeAMQPBroker) writeMethod(w io.Writer, channel uint16, class, method uint16, args ...[]byte) {
+	payload := append(amqpUint16(class), amqpUint16(method)...)
+	for _, arg := range args {
+		payload = append(payload, arg...)
+	}
+
+	var frame bytes.Buffer
+	frame.WriteByte(1)
+	frame.Write(amqpUint16(channel))
+	frame.Write(amqpUint32(uint32(len(payload))))
+	frame.Write(payload)
+	frame.WriteByte(0xCE)
+	w.Write(frame.Bytes())
+}
+
+func readAMQPFrame(r io.Reader) (byte, uint16, []byte, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(header[3:7])+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, 0, nil, err
+	}
+
+	return header[0], binary.BigEndian.Uint16(header[1:3]), payload[:len(payload)-1], nil
+}
+
+func readAMQPShortString(b []byte) (string, []byte) {
+	n := int(b[0])
+	return string(b[1 : 1+n]), b[1+n:]
+}
+
+func amqpUint16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func amqpUint32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+func amqpUint64(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
+func amqpTable() []byte          { return amqpUint32(0) }
+
+func amqpLongString(s string) []byte {
+	return append(amqpUint32(uint32(len(s))), s...)
+}
+
+func TestAMQPSink(t *testing.T) {
+	broker := newFakeAMQPBroker(t)
+
+	sink, err := NewAMQPSink(AMQPConfig{
+		URL:             broker.URL(),
+		Exchange:        "nomad.events",
+		DeclareExchange: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create amqp sink: %v", err)
+	}
+	defer sink.Close()
+
+	event := NewEvent(EventTypeDeployment, &api.Deployment{ID: "d-1", Namespace: "prod", JobID: "web"})
+	if err := sink.Write(event); err != nil {
+		t.Fatalf("AMQPSink.Write() error = %v", err)
+	}
+	waitForDelivered(t, sink, 1)
+
+	broker.mu.Lock()
+	declared := broker.declared
+	broker.mu.Unlock()
+	if len(declared) != 1 || declared[0] != "nomad.events" {
+		t.Errorf("Expected the exchange to be declared, got %v", declared)
+	}
+
+	messages := broker.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(messages))
+	}
+
+	msg := messages[0]
+	if msg.exchange != "nomad.events" {
+		t.Errorf("Expected exchange nomad.events, got %q", msg.exchange)
+	}
+	if msg.routingKey != "nomad.deployment.prod.web" {
+		t.Errorf("Expected routing key nomad.deployment.prod.web, got %q", msg.routingKey)
+	}
+	if msg.contentType != "application/json" {
+		t.Errorf("Expected JSON content type, got %q", msg.contentType)
+	}
+	if msg.deliveryMode != 2 {
+		t.Errorf("Expected a persistent message, got delivery mode %d", msg.deliveryMode)
+	}
+	if !bytes.Contains(msg.body, []byte(`"ID":"d-1"`)) {
+		t.Errorf("Expected the event in the body, got %s", msg.body)
+	}
+}
+
+func TestAMQPSink_Reconnect(t *testing.T) {
+	broker := newFakeAMQPBroker(t)
+	broker.dropAfter = 1
+
+	sink, err := NewAMQPSink(AMQPConfig{
+		URL:      broker.URL(),
+		Exchange: "nomad.events",
+		Retry:    RetryConfig{MaxRetries: 3, InitialBackoff: 10 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create amqp sink: %v", err)
+	}
+	defer sink.Close()
+
+	for _, id := range []string{"web", "api", "db"} {
+		if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: id, Namespace: "default"})); err != nil {
+			t.Fatalf("AMQPSink.Write() error = %v", err)
+		}
+	}
+	waitForDelivered(t, sink, 3)
+
+	messages := broker.Messages()
+	if len(messages) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(messages))
+	}
+	if messages[2].routingKey != "nomad.job.default.db" {
+		t.Errorf("Expected routing key nomad.job.default.db, got %q", messages[2].routingKey)
+	}
+}
+
+func TestAMQPSink_Nack(t *testing.T) {
+	broker := newFakeAMQPBroker(t)
+	broker.nack = true
+
+	sink, err := NewAMQPSink(AMQPConfig{
+		URL:      broker.URL(),
+		Exchange: "nomad.events",
+		Retry:    RetryConfig{MaxRetries: 1, InitialBackoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create amqp sink: %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.send([]*Event{NewEvent(EventTypeJob, &api.JobListStub{ID: "web"})}); err == nil {
+		t.Fatal("Expected an error for a rejected message")
+	}
+
+	if got := len(broker.Messages()); got != 2 {
+		t.Errorf("Expected the rejected message to be sent twice, got %d", got)
+	}
+}
@@ -0,0 +1,216 @@
+package agent
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxQueuedBatches caps the events a batcher keeps while its destination is
+// unavailable, in multiples of the batch size
+const maxQueuedBatches = 100
+
+// eventBatcher groups events and hands them to a flush function running in
+// the background once the batch is full or the flush interval has elapsed.
+// Batches that fail with a retryable error are kept and sent again on the
+// next flush, so events are delivered in order and the delivered count only
+// covers sent events.
+type eventBatcher struct {
+	name      string
+	flush     func(events []*Event) error
+	size      int
+	interval  time.Duration
+	events    []*Event
+	maxQueued int
+	accepted  uint64
+	delivered uint64
+	closed    bool
+	mu        sync.Mutex
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+
+	// ready wakes the flusher once a batch is full
+	ready chan struct{}
+
+	// flushed is signalled as the queue drains and after every flush
+	// attempt, waking writers waiting for room in the queue. attempts counts
+	// the attempts started and finished the attempts completed.
+	flushed  *sync.Cond
+	attempts uint64
+	finished uint64
+}
+
+// newEventBatcher creates a batcher. Without an interval, events are only
+// flushed once the batch is full or the batcher is closed.
+func newEventBatcher(name string, config BatchConfig, flush func(events []*Event) error) *eventBatcher {
+	size := config.Size
+	if size < 1 {
+		size = 1
+	}
+
+	b := &eventBatcher{
+		name:      name,
+		flush:     flush,
+		size:      size,
+		interval:  config.Interval,
+		maxQueued: size * maxQueuedBatches,
+		stopChan:  make(chan struct{}),
+		ready:     make(chan struct{}, 1),
+	}
+	b.flushed = sync.NewCond(&b.mu)
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		b.run()
+	}()
+
+	return b
+}
+
+// Add queues the event and wakes the flusher when the batch is full. While
+// the queue is at capacity, Add waits for the next flush attempt and rejects
+// the event when it did not make room.
+func (b *eventBatcher) Add(event *Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.events) >= b.maxQueued && !b.closed {
+		next := b.attempts + 1
+		b.wake()
+		for len(b.events) >= b.maxQueued && b.finished < next {
+			b.flushed.Wait()
+		}
+	}
+	if len(b.events) >= b.maxQueued {
+		return fmt.Errorf("%s queue is full, event dropped", b.name)
+	}
+
+	b.events = append(b.events, event)
+	b.accepted++
+	if len(b.events) >= b.size {
+		b.wake()
+	}
+
+	return nil
+}
+
+// wake signals the flusher without waiting for it
+func (b *eventBatcher) wake() {
+	select {
+	case b.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Accepted returns the number of events queued so far
+func (b *eventBatcher) Accepted() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.accepted
+}
+
+// Delivered returns the number of events sent, or dropped after a failure
+// that can not succeed later, in queue order
+func (b *eventBatcher) Delivered() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.delivered
+}
+
+// Close stops the flusher and flushes the queued events, failing when some
+// of them could not be delivered
+func (b *eventBatcher) Close() error {
+	close(b.stopChan)
+	b.wg.Wait()
+
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+
+	if err := b.flushQueued(true); err != nil {
+		b.mu.Lock()
+		lost := len(b.events)
+		b.mu.Unlock()
+
+		return fmt.Errorf("%d queued events were not delivered: %w", lost, err)
+	}
+
+	return nil
+}
+
+// run flushes full batches when woken, and every queued event every interval
+func (b *eventBatcher) run() {
+	var tick <-chan time.Time
+	if b.interval > 0 {
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		all := false
+		select {
+		case <-b.stopChan:
+			return
+		case <-b.ready:
+		case <-tick:
+			all = true
+		}
+
+		if err := b.flushQueued(all); err != nil {
+			GetLogger().Error("Failed to flush event batch",
+				"sink", b.name,
+				"error", err.Error(),
+			)
+		}
+	}
+}
+
+// flushQueued hands the queued events to the flush function, one batch at a
+// time, until no full batch is left, or the queue is empty when all is set,
+// or a batch fails. Batches failing with a retryable error stay at the head
+// of the queue; other failures can not succeed later, so the batch is
+// dropped. Only the flusher, or Close once it stopped, calls it.
+func (b *eventBatcher) flushQueued(all bool) error {
+	b.mu.Lock()
+	b.attempts++
+	attempt := b.attempts
+	b.mu.Unlock()
+
+	// Writers waiting for room give up once the attempt could not make any
+	defer func() {
+		b.mu.Lock()
+		b.finished = attempt
+		b.flushed.Broadcast()
+		b.mu.Unlock()
+	}()
+
+	for {
+		b.mu.Lock()
+		n := min(len(b.events), b.size)
+		batch := b.events[:n:n]
+		b.mu.Unlock()
+
+		if n == 0 || (n < b.size && !all) {
+			return nil
+		}
+
+		err := b.flush(batch)
+		if err != nil && isRetryable(err) {
+			return err
+		}
+
+		b.mu.Lock()
+		b.events = b.events[n:]
+		b.delivered += uint64(n)
+		b.flushed.Broadcast()
+		b.mu.Unlock()
+
+		if err != nil {
+			return fmt.Errorf("dropped batch of %d events: %w", n, err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForDelivered fails the test when the sink does not report the
+// delivered events in time
+func waitForDelivered(t *testing.T, tracker DeliveryTracker, want uint64) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for tracker.Delivered() < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d delivered events, got %d", want, tracker.Delivered())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEventBatcher_FlushesInBackground(t *testing.T) {
+	release := make(chan struct{})
+	var flushed atomic.Int64
+
+	batcher := newEventBatcher("test", BatchConfig{Size: 1}, func(events []*Event) error {
+		<-release
+		flushed.Add(int64(len(events)))
+		return nil
+	})
+
+	// A slow flush does not hold up writers while there is room
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			if err := batcher.Add(NewEvent(EventTypeJob, nil)); err != nil {
+				t.Errorf("eventBatcher.Add() error = %v", err)
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Add to return while the flush is running")
+	}
+
+	close(release)
+	waitForDelivered(t, batcher, 10)
+
+	if err := batcher.Close(); err != nil {
+		t.Fatalf("eventBatcher.Close() error = %v", err)
+	}
+	if flushed.Load() != 10 {
+		t.Errorf("Expected 10 flushed events, got %d", flushed.Load())
+	}
+}
+
+func TestEventBatcher_WaitsAtCapacity(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+
+	batcher := newEventBatcher("test", BatchConfig{Size: 1}, func(events []*Event) error {
+		if failing.Load() {
+			return retryable(fmt.Errorf("unavailable"))
+		}
+		return nil
+	})
+	defer batcher.Close()
+
+	for i := 0; i < maxQueuedBatches; i++ {
+		if err := batcher.Add(NewEvent(EventTypeJob, nil)); err != nil {
+			t.Fatalf("eventBatcher.Add() error = %v", err)
+		}
+	}
+
+	// A full queue that a flush attempt could not drain rejects the event
+	if err := batcher.Add(NewEvent(EventTypeJob, nil)); err == nil {
+		t.Error("Expected an error while the queue is full")
+	}
+
+	// Once the destination recovers, the writer waits for the flush to make
+	// room instead of failing
+	failing.Store(false)
+	if err := batcher.Add(NewEvent(EventTypeJob, nil)); err != nil {
+		t.Errorf("eventBatcher.Add() error = %v", err)
+	}
+	waitForDelivered(t, batcher, maxQueuedBatches+1)
+}
@@ -0,0 +1,199 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Chat providers
+const (
+	ChatProviderSlack      = "slack"
+	ChatProviderMattermost = "mattermost"
+	ChatProviderDiscord    = "discord"
+)
+
+// DefaultChatTemplate is used for targets without a template file
+const DefaultChatTemplate = `Nomad {{.Type}} event` +
+	`{{with .Action}} ({{.}}){{end}}` +
+	`{{with $.Field "namespace"}} in {{.}}{{end}}` +
+	`{{with $.Field "job"}}: job {{.}}{{end}}` +
+	`{{with $.Field "task_group"}}, group {{.}}{{end}}` +
+	`{{with $.Field "task"}}, task {{.}}{{end}}` +
+	`{{with $.Field "node"}}, node {{.}}{{end}}`
+
+// discordMaxContent is the maximum length of a Discord message
+const discordMaxContent = 2000
+
+// chatTarget is a webhook that events matching its filter are posted to
+type chatTarget struct {
+	ChatTarget
+	template *template.Template
+}
+
+// ChatSink posts events rendered from text templates to Slack, Mattermost
+// and Discord incoming webhooks. Messages are posted in the background, so a
+// slow webhook does not hold up the event managers.
+type ChatSink struct {
+	config  ChatConfig
+	client  *http.Client
+	targets []*chatTarget
+	batcher *eventBatcher
+
+	// posted holds the targets that received postedEvent, so posting it
+	// again after a failure skips them
+	postedEvent *Event
+	posted      map[*chatTarget]bool
+}
+
+func NewChatSink(config ChatConfig) (*ChatSink, error) {
+	if len(config.Targets) == 0 {
+		return nil, fmt.Errorf("at least one chat target is required")
+	}
+
+	s := &ChatSink{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}
+
+	for _, target := range config.Targets {
+		tmpl, err := parseChatTemplate(target.Template)
+		if err != nil {
+			return nil, fmt.Errorf("chat target %s: %w", target.Name, err)
+		}
+
+		s.targets = append(s.targets, &chatTarget{ChatTarget: target, template: tmpl})
+	}
+
+	s.batcher = newEventBatcher("chat", BatchConfig{Size: 1}, s.send)
+
+	return s, nil
+}
+
+// parseChatTemplate parses the template file, or the default template when
+// no file is given
+func parseChatTemplate(path string) (*template.Template, error) {
+	if path == "" {
+		return template.New("default").Parse(DefaultChatTemplate)
+	}
+
+	tmpl, err := template.New(filepath.Base(path)).ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", path, err)
+	}
+	return tmpl, nil
+}
+
+// Write queues the event when it matches the filter of any target
+func (s *ChatSink) Write(event *Event) error {
+	for _, target := range s.targets {
+		if target.Filter.Matches(event) {
+			return s.batcher.Add(event)
+		}
+	}
+
+	return nil
+}
+
+func (s *ChatSink) Accepted() uint64 {
+	return s.batcher.Accepted()
+}
+
+func (s *ChatSink) Delivered() uint64 {
+	return s.batcher.Delivered()
+}
+
+// send posts every event to the targets whose filter it matches. Events that
+// failed with a transient error stay queued in the batcher and are posted
+// again with the next flush, only to the targets that did not receive them.
+func (s *ChatSink) send(events []*Event) error {
+	for _, event := range events {
+		if event != s.postedEvent {
+			s.postedEvent = event
+			s.posted = make(map[*chatTarget]bool)
+		}
+
+		var errs []error
+		for _, target := range s.targets {
+			if s.posted[target] || !target.Filter.Matches(event) {
+				continue
+			}
+
+			if err := s.post(target, event); err != nil {
+				errs = append(errs, fmt.Errorf("chat target %s: %w", target.Name, err))
+				continue
+			}
+			s.posted[target] = true
+		}
+
+		if err := errors.Join(errs...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// post renders the event and sends it to the target. Templates rendering
+// only whitespace skip the event.
+func (s *ChatSink) post(target *chatTarget, event *Event) error {
+	var message strings.Builder
+	if err := target.template.Execute(&message, event); err != nil {
+		return fmt.Errorf("failed to render template: %w", err)
+	}
+
+	text := strings.TrimSpace(message.String())
+	if text == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(chatPayload(target.Provider, text))
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	return withRetry(s.config.Retry, func() error {
+		req, err := http.NewRequest(http.MethodPost, target.URL, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := doHTTPRequest(s.client, req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+
+		return nil
+	})
+}
+
+// chatPayload returns the webhook body of the provider
+func chatPayload(provider, text string) map[string]string {
+	if provider == ChatProviderDiscord {
+		return map[string]string{"content": truncate(text, discordMaxContent)}
+	}
+
+	// Slack and Mattermost share the same incoming webhook format
+	return map[string]string{"text": text}
+}
+
+func (s *ChatSink) Close() error {
+	return s.batcher.Close()
+}
+
+// truncate shortens the string to at most limit characters
+func truncate(s string, limit int) string {
+	if runes := []rune(s); len(runes) > limit {
+		return string(runes[:limit-1]) + "…"
+	}
+	return s
+}
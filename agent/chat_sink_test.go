@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestChatSink(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string][]map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode payload: %v", err)
+		}
+
+		mu.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], payload)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	templatePath := filepath.Join(t.TempDir(), "oom.tmpl")
+	template := `{{.Data.TaskEvent.DisplayMessage}}: {{.Data.JobID}}/{{.Data.TaskGroup}}/{{.Data.TaskName}} exited with {{.Data.TaskEvent.ExitCode}}`
+	if err := os.WriteFile(templatePath, []byte(template), 0o644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	sink, err := NewChatSink(ChatConfig{
+		Targets: []ChatTarget{
+			{
+				Name:     "deployments",
+				Provider: ChatProviderSlack,
+				URL:      server.URL + "/slack",
+				Filter: EventFilter{
+					Types: []string{EventTypeDeployment},
+					Match: map[string][]string{"Status": {api.DeploymentStatusFailed}},
+				},
+			},
+			{
+				Name:     "oom-kills",
+				Provider: ChatProviderDiscord,
+				URL:      server.URL + "/discord",
+				Template: templatePath,
+				Filter: EventFilter{
+					Types: []string{EventTypeTask},
+					Match: map[string][]string{"TaskEvent.Details.oom_killed": {"true"}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create chat sink: %v", err)
+	}
+	defer sink.Close()
+
+	events := []*Event{
+		NewEvent(EventTypeDeployment, &api.Deployment{ID: "d-1", Namespace: "default", JobID: "api", Status: api.DeploymentStatusFailed}),
+		NewEvent(EventTypeDeployment, &api.Deployment{ID: "d-2", Namespace: "default", JobID: "api", Status: api.DeploymentStatusSuccessful}),
+		NewEvent(EventTypeTask, &TaskEvent{
+			JobID:     "web",
+			TaskGroup: "frontend",
+			TaskName:  "nginx",
+			TaskEvent: &api.TaskEvent{
+				Type:           api.TaskTerminated,
+				ExitCode:       137,
+				DisplayMessage: "OOM Killed",
+				Details:        map[string]string{"oom_killed": "true"},
+			},
+		}),
+	}
+	for _, event := range events {
+		if err := sink.Write(event); err != nil {
+			t.Fatalf("ChatSink.Write() error = %v", err)
+		}
+	}
+	waitForDelivered(t, sink, 2)
+	mu.Lock()
+	defer mu.Unlock()
+
+	slack := received["/slack"]
+	if len(slack) != 1 {
+		t.Fatalf("Expected 1 slack message, got %d", len(slack))
+	}
+	if want := "Nomad deployment event in default: job api"; slack[0]["text"] != want {
+		t.Errorf("Expected slack text %q, got %q", want, slack[0]["text"])
+	}
+
+	discord := received["/discord"]
+	if len(discord) != 1 {
+		t.Fatalf("Expected 1 discord message, got %d", len(discord))
+	}
+	if want := "OOM Killed: web/frontend/nginx exited with 137"; discord[0]["content"] != want {
+		t.Errorf("Expected discord content %q, got %q", want, discord[0]["content"])
+	}
+}
+
+func TestChatPayload_DiscordTruncation(t *testing.T) {
+	payload := chatPayload(ChatProviderDiscord, strings.Repeat("a", 3000))
+	if got := len([]rune(payload["content"])); got != discordMaxContent {
+		t.Errorf("Expected content of %d characters, got %d", discordMaxContent, got)
+	}
+}
+
+func TestNewChatSink_InvalidTemplate(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "broken.tmpl")
+	if err := os.WriteFile(templatePath, []byte("{{.Type"), 0o644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+
+	_, err := NewChatSink(ChatConfig{
+		Targets: []ChatTarget{{Name: "broken", Provider: ChatProviderSlack, URL: "http://localhost", Template: templatePath}},
+	})
+	if err == nil {
+		t.Error("Expected an error for an invalid template")
+	}
+}
@@ -0,0 +1,390 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+)
+
+// Checkpoint is the position up to which a manager has written events.
+// Managers reporting deleted objects also save the IDs of the objects they
+// know in the file store, so objects purged while the agent is down are
+// reported after a restart.
+type Checkpoint struct {
+	Index        uint64   `json:"index"`
+	LastSeenTime int64    `json:"last_seen_time,omitempty"`
+	Objects      []string `json:"objects,omitempty"`
+}
+
+// equal returns whether both checkpoints hold the same position and objects
+func (c Checkpoint) equal(other Checkpoint) bool {
+	return c.Index == other.Index && c.LastSeenTime == other.LastSeenTime && slices.Equal(c.Objects, other.Objects)
+}
+
+// CheckpointStore defines the interface for persisting manager checkpoints
+type CheckpointStore interface {
+	// Load returns the checkpoint saved under key, or nil if there is none
+	Load(key string) (*Checkpoint, error)
+	Save(key string, checkpoint *Checkpoint) error
+	Close() error
+}
+
+// FileCheckpointStore keeps checkpoints in a local JSON file
+type FileCheckpointStore struct {
+	path        string
+	checkpoints map[string]*Checkpoint
+	mu          sync.Mutex
+}
+
+func NewFileCheckpointStore(path string) (*FileCheckpointStore, error) {
+	store := &FileCheckpointStore{
+		path:        path,
+		checkpoints: make(map[string]*Checkpoint),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint file %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, &store.checkpoints); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint file %s: %w", path, err)
+	}
+
+	return store, nil
+}
+
+func (s *FileCheckpointStore) Load(key string) (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoint, ok := s.checkpoints[key]
+	if !ok {
+		return nil, nil
+	}
+
+	loaded := *checkpoint
+	return &loaded, nil
+}
+
+func (s *FileCheckpointStore) Save(key string, checkpoint *Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *checkpoint
+	s.checkpoints[key] = &saved
+
+	data, err := json.Marshal(s.checkpoints)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoints: %w", err)
+	}
+
+	// Write to a temporary file and rename it over the checkpoint file so a
+	// crash mid-write never leaves a truncated checkpoint behind
+	tmpfile, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint file: %w", err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write(data); err != nil {
+		tmpfile.Close()
+		return fmt.Errorf("failed to write checkpoint file: %w", err)
+	}
+
+	if err := tmpfile.Sync(); err != nil {
+		tmpfile.Close()
+		return fmt.Errorf("failed to sync checkpoint file: %w", err)
+	}
+
+	if err := tmpfile.Close(); err != nil {
+		return fmt.Errorf("failed to close checkpoint file: %w", err)
+	}
+
+	if err := os.Rename(tmpfile.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace checkpoint file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FileCheckpointStore) Close() error {
+	return nil
+}
+
+// restoreCheckpoint resumes the manager from its saved checkpoint, if any.
+// A restored manager no longer skips its first poll, so events that happened
+// while the agent was down are emitted.
+func (m *BaseManager) restoreCheckpoint() *Checkpoint {
+	if m.checkpoints == nil {
+		return nil
+	}
+
+	checkpoint, err := m.checkpoints.Load(m.checkpointKey())
+	if err != nil {
+		m.logger.Error("Failed to load checkpoint",
+			"event_type", m.eventType,
+			"cluster", m.cluster,
+			"error", err.Error(),
+		)
+		return nil
+	}
+
+	if checkpoint == nil {
+		return nil
+	}
+
+	m.lastIndex = checkpoint.Index
+	m.firstRun = false
+	m.savedCheckpoint = *checkpoint
+
+	m.logger.Info("Resuming from checkpoint",
+		"event_type", m.eventType,
+		"cluster", m.cluster,
+		"index", checkpoint.Index,
+	)
+
+	return checkpoint
+}
+
+// maxPendingCheckpoints caps the checkpoints a manager keeps while waiting
+// for sinks to deliver their queued events
+const maxPendingCheckpoints = 1000
+
+// pendingCheckpoint is a checkpoint waiting for the events written before it
+// to be delivered
+type pendingCheckpoint struct {
+	checkpoint Checkpoint
+	accepted   []uint64
+}
+
+// saveCheckpoint persists the manager's position when every event written
+// since the previous save reached all sinks. Sinks delivering events in the
+// background hold the checkpoint back until the events are delivered.
+func (m *BaseManager) saveCheckpoint(checkpoint Checkpoint) {
+	if m.checkpoints == nil {
+		return
+	}
+
+	m.mu.Lock()
+	writeFailed := m.writeFailed
+	m.writeFailed = false
+	m.mu.Unlock()
+
+	if writeFailed {
+		m.logger.Error("Skipping checkpoint after failed sink writes",
+			"event_type", m.eventType,
+			"cluster", m.cluster,
+			"index", checkpoint.Index,
+		)
+	} else {
+		pending := pendingCheckpoint{checkpoint: checkpoint}
+		for _, sink := range m.sinks {
+			if tracker, ok := sink.(DeliveryTracker); ok {
+				pending.accepted = append(pending.accepted, tracker.Accepted())
+			}
+		}
+
+		// Dropping the oldest checkpoint only delays the next save
+		if len(m.pendingCheckpoints) >= maxPendingCheckpoints {
+			m.pendingCheckpoints = m.pendingCheckpoints[1:]
+		}
+		m.pendingCheckpoints = append(m.pendingCheckpoints, pending)
+	}
+
+	m.savePendingCheckpoint()
+}
+
+// FlushCheckpoint saves the newest pending checkpoint after the manager
+// stopped, so events the sinks delivered on shutdown are not replayed
+func (m *BaseManager) FlushCheckpoint() {
+	m.savePendingCheckpoint()
+}
+
+// savePendingCheckpoint saves the newest pending checkpoint whose events
+// were delivered by every sink
+func (m *BaseManager) savePendingCheckpoint() {
+	if m.checkpoints == nil {
+		return
+	}
+
+	var delivered []uint64
+	for _, sink := range m.sinks {
+		if tracker, ok := sink.(DeliveryTracker); ok {
+			delivered = append(delivered, tracker.Delivered())
+		}
+	}
+
+	ready := 0
+	for ready < len(m.pendingCheckpoints) && checkpointDelivered(m.pendingCheckpoints[ready], delivered) {
+		ready++
+	}
+	if ready == 0 {
+		return
+	}
+
+	checkpoint := m.pendingCheckpoints[ready-1].checkpoint
+	m.pendingCheckpoints = m.pendingCheckpoints[ready:]
+
+	if checkpoint.equal(m.savedCheckpoint) {
+		return
+	}
+
+	if err := m.checkpoints.Save(m.checkpointKey(), &checkpoint); err != nil {
+		m.logger.Error("Failed to save checkpoint",
+			"event_type", m.eventType,
+			"cluster", m.cluster,
+			"error", err.Error(),
+		)
+		return
+	}
+
+	m.savedCheckpoint = checkpoint
+}
+
+// checkpointDelivered returns whether the sinks delivered every event
+// written before the checkpoint
+func checkpointDelivered(pending pendingCheckpoint, delivered []uint64) bool {
+	for i, accepted := range pending.accepted {
+		if delivered[i] < accepted {
+			return false
+		}
+	}
+	return true
+}
+
+// checkpointObjects returns the IDs of the objects to save with the
+// checkpoint. Only the file store keeps them: a Nomad Variable is limited in
+// size, and the IDs of a large cluster would make every save fail.
+func (m *BaseManager) checkpointObjects(ids func() []string) []string {
+	if _, ok := m.checkpoints.(*FileCheckpointStore); !ok {
+		return nil
+	}
+	return ids()
+}
+
+// checkpointKey returns the key the manager's checkpoint is stored under
+func (m *BaseManager) checkpointKey() string {
+	if m.cluster == "" {
+		return m.eventType
+	}
+	return m.cluster + "/" + m.eventType
+}
+
+// VariablesCheckpointStore keeps checkpoints in a Nomad Variable so that
+// every agent instance sharing the variable resumes from the same position.
+// Writes only succeed while the variable is unchanged since it was last read
+// or written, so an instance that lost leadership can not overwrite the
+// checkpoints of the new leader with a write based on older ones.
+type VariablesCheckpointStore struct {
+	nomadClient *nomadapi.Client
+	path        string
+	checkpoints map[string]*Checkpoint
+	modifyIndex uint64
+	mu          sync.Mutex
+}
+
+// variablesCheckpointItem is the variable item holding the encoded checkpoints
+const variablesCheckpointItem = "checkpoints"
+
+func NewVariablesCheckpointStore(cluster ClusterConfig, path string) (*VariablesCheckpointStore, error) {
+	client, err := newNomadClient(cluster, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &VariablesCheckpointStore{
+		nomadClient: client,
+		path:        path,
+		checkpoints: make(map[string]*Checkpoint),
+	}, nil
+}
+
+// Load reads the variable on every call so a newly elected leader picks up
+// the checkpoints saved by the previous one
+func (s *VariablesCheckpointStore) Load(key string) (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.read(); err != nil {
+		return nil, err
+	}
+
+	checkpoint, ok := s.checkpoints[key]
+	if !ok {
+		return nil, nil
+	}
+
+	loaded := *checkpoint
+	return &loaded, nil
+}
+
+// read replaces the cached checkpoints and modify index with the current
+// contents of the variable
+func (s *VariablesCheckpointStore) read() error {
+	variable, _, err := s.nomadClient.Variables().Peek(s.path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint variable %s: %w", s.path, err)
+	}
+
+	checkpoints := make(map[string]*Checkpoint)
+	s.modifyIndex = 0
+	if variable != nil {
+		s.modifyIndex = variable.ModifyIndex
+	}
+	if variable != nil && variable.Items[variablesCheckpointItem] != "" {
+		if err := json.Unmarshal([]byte(variable.Items[variablesCheckpointItem]), &checkpoints); err != nil {
+			return fmt.Errorf("failed to parse checkpoint variable %s: %w", s.path, err)
+		}
+	}
+	s.checkpoints = checkpoints
+	return nil
+}
+
+func (s *VariablesCheckpointStore) Save(key string, checkpoint *Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *checkpoint
+	s.checkpoints[key] = &saved
+
+	data, err := json.Marshal(s.checkpoints)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoints: %w", err)
+	}
+
+	variable := nomadapi.NewVariable(s.path)
+	variable.Items[variablesCheckpointItem] = string(data)
+	variable.ModifyIndex = s.modifyIndex
+
+	updated, _, err := s.nomadClient.Variables().CheckedUpdate(variable, nil)
+	if err != nil {
+		// The conflicting write is refused. Reading the variable again lets
+		// the following writes succeed instead of failing until the next Load.
+		var conflict nomadapi.ErrCASConflict
+		if errors.As(err, &conflict) {
+			err = fmt.Errorf("checkpoint variable %s was written by another instance: %w", s.path, err)
+			if readErr := s.read(); readErr != nil {
+				return errors.Join(err, readErr)
+			}
+			return err
+		}
+		return fmt.Errorf("failed to write checkpoint variable %s: %w", s.path, err)
+	}
+
+	s.modifyIndex = updated.ModifyIndex
+	return nil
+}
+
+func (s *VariablesCheckpointStore) Close() error {
+	return nil
+}
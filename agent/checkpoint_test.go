@@ -0,0 +1,280 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+)
+
+func TestFileCheckpointStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+
+	store, err := NewFileCheckpointStore(path)
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint store: %v", err)
+	}
+
+	checkpoint, err := store.Load("job")
+	if err != nil {
+		t.Fatalf("FileCheckpointStore.Load() error = %v", err)
+	}
+	if checkpoint != nil {
+		t.Errorf("Expected no checkpoint, got %+v", checkpoint)
+	}
+
+	if err := store.Save("job", &Checkpoint{Index: 42}); err != nil {
+		t.Fatalf("FileCheckpointStore.Save() error = %v", err)
+	}
+	if err := store.Save("east/allocation", &Checkpoint{Index: 7, LastSeenTime: 1640995200}); err != nil {
+		t.Fatalf("FileCheckpointStore.Save() error = %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("FileCheckpointStore.Close() error = %v", err)
+	}
+
+	// Checkpoints survive reopening the store
+	reopened, err := NewFileCheckpointStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen checkpoint store: %v", err)
+	}
+
+	checkpoint, err = reopened.Load("east/allocation")
+	if err != nil {
+		t.Fatalf("FileCheckpointStore.Load() error = %v", err)
+	}
+	if checkpoint == nil || checkpoint.Index != 7 || checkpoint.LastSeenTime != 1640995200 {
+		t.Errorf("Expected checkpoint {7 1640995200}, got %+v", checkpoint)
+	}
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("Failed to read checkpoint directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the checkpoint file, got %d entries", len(entries))
+	}
+}
+
+func TestFileCheckpointStore_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatalf("Failed to write checkpoint file: %v", err)
+	}
+
+	if _, err := NewFileCheckpointStore(path); err == nil {
+		t.Error("Expected error for invalid checkpoint file, got nil")
+	}
+}
+
+func TestVariablesCheckpointStore(t *testing.T) {
+	var stored *nomadapi.Variable
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/var/nomad-event-logger/checkpoints" {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			if stored == nil {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(stored)
+		case http.MethodPut:
+			// Writes are checked against the modify index like Nomad does
+			var index uint64
+			if stored != nil {
+				index = stored.ModifyIndex
+			}
+			if r.URL.Query().Get("cas") != strconv.FormatUint(index, 10) {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(stored)
+				return
+			}
+
+			stored = new(nomadapi.Variable)
+			if err := json.NewDecoder(r.Body).Decode(stored); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			stored.ModifyIndex = index + 1
+			json.NewEncoder(w).Encode(stored)
+		}
+	}))
+	defer server.Close()
+
+	store, err := NewVariablesCheckpointStore(ClusterConfig{Address: server.URL}, "nomad-event-logger/checkpoints")
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint store: %v", err)
+	}
+
+	checkpoint, err := store.Load("job")
+	if err != nil {
+		t.Fatalf("VariablesCheckpointStore.Load() error = %v", err)
+	}
+	if checkpoint != nil {
+		t.Errorf("Expected no checkpoint, got %+v", checkpoint)
+	}
+
+	if err := store.Save("job", &Checkpoint{Index: 42}); err != nil {
+		t.Fatalf("VariablesCheckpointStore.Save() error = %v", err)
+	}
+
+	// A second instance sharing the variable sees the saved checkpoint
+	other, err := NewVariablesCheckpointStore(ClusterConfig{Address: server.URL}, "nomad-event-logger/checkpoints")
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint store: %v", err)
+	}
+
+	checkpoint, err = other.Load("job")
+	if err != nil {
+		t.Fatalf("VariablesCheckpointStore.Load() error = %v", err)
+	}
+	if checkpoint == nil || checkpoint.Index != 42 {
+		t.Errorf("Expected checkpoint {42 0}, got %+v", checkpoint)
+	}
+
+	if err := other.Save("job", &Checkpoint{Index: 50}); err != nil {
+		t.Fatalf("VariablesCheckpointStore.Save() error = %v", err)
+	}
+
+	// The first instance must not overwrite the newer checkpoint
+	if err := store.Save("job", &Checkpoint{Index: 45}); err == nil {
+		t.Error("Expected error saving over a checkpoint written by another instance, got nil")
+	}
+
+	// After the conflict the first instance writes on top of the current
+	// checkpoints again
+	if err := store.Save("node", &Checkpoint{Index: 7}); err != nil {
+		t.Fatalf("VariablesCheckpointStore.Save() error = %v", err)
+	}
+
+	checkpoint, err = other.Load("job")
+	if err != nil {
+		t.Fatalf("VariablesCheckpointStore.Load() error = %v", err)
+	}
+	if checkpoint == nil || checkpoint.Index != 50 {
+		t.Errorf("Expected checkpoint {50 0}, got %+v", checkpoint)
+	}
+
+	checkpoint, err = other.Load("node")
+	if err != nil {
+		t.Fatalf("VariablesCheckpointStore.Load() error = %v", err)
+	}
+	if checkpoint == nil || checkpoint.Index != 7 {
+		t.Errorf("Expected checkpoint {7 0}, got %+v", checkpoint)
+	}
+}
+
+// trackedSink is a sink delivering events in the background
+type trackedSink struct {
+	accepted  uint64
+	delivered uint64
+}
+
+func (s *trackedSink) Write(event *Event) error {
+	s.accepted++
+	return nil
+}
+
+func (s *trackedSink) Close() error {
+	return nil
+}
+
+func (s *trackedSink) Accepted() uint64 {
+	return s.accepted
+}
+
+func (s *trackedSink) Delivered() uint64 {
+	return s.delivered
+}
+
+func TestSaveCheckpoint_WaitsForDelivery(t *testing.T) {
+	store, err := NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint store: %v", err)
+	}
+
+	sink := &trackedSink{}
+	m := &BaseManager{
+		sinks:       []Sink{NewStdoutSink(), sink},
+		eventType:   EventTypeJob,
+		checkpoints: store,
+		logger:      GetLogger(),
+	}
+
+	saved := func() uint64 {
+		checkpoint, err := store.Load(EventTypeJob)
+		if err != nil {
+			t.Fatalf("FileCheckpointStore.Load() error = %v", err)
+		}
+		if checkpoint == nil {
+			return 0
+		}
+		return checkpoint.Index
+	}
+
+	// Queued events hold the checkpoint back
+	sink.accepted = 2
+	m.saveCheckpoint(Checkpoint{Index: 10})
+	if index := saved(); index != 0 {
+		t.Fatalf("Expected no checkpoint while events are queued, got %d", index)
+	}
+
+	sink.accepted = 5
+	m.saveCheckpoint(Checkpoint{Index: 20})
+	if index := saved(); index != 0 {
+		t.Fatalf("Expected no checkpoint while events are queued, got %d", index)
+	}
+
+	// Only the checkpoints whose events were delivered are saved
+	sink.delivered = 3
+	m.saveCheckpoint(Checkpoint{Index: 30})
+	if index := saved(); index != 10 {
+		t.Errorf("Expected checkpoint 10, got %d", index)
+	}
+
+	sink.delivered = 5
+	m.savePendingCheckpoint()
+	if index := saved(); index != 30 {
+		t.Errorf("Expected checkpoint 30, got %d", index)
+	}
+
+	// Failed writes skip the checkpoint entirely
+	m.writeFailed = true
+	m.saveCheckpoint(Checkpoint{Index: 40})
+	if index := saved(); index != 30 {
+		t.Errorf("Expected checkpoint 30 after failed writes, got %d", index)
+	}
+}
+
+func TestCheckpointObjects(t *testing.T) {
+	ids := func() []string { return []string{"default/web"} }
+
+	fileStore, err := NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint store: %v", err)
+	}
+	m := &BaseManager{checkpoints: fileStore}
+	if objects := m.checkpointObjects(ids); len(objects) != 1 {
+		t.Errorf("Expected the file store to keep the object IDs, got %v", objects)
+	}
+
+	variablesStore, err := NewVariablesCheckpointStore(ClusterConfig{Address: "http://127.0.0.1:4646"}, "nomad-event-logger/checkpoints")
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint store: %v", err)
+	}
+	m = &BaseManager{checkpoints: variablesStore}
+	if objects := m.checkpointObjects(ids); objects != nil {
+		t.Errorf("Expected the Nomad Variable store not to keep object IDs, got %v", objects)
+	}
+}
@@ -2,30 +2,344 @@ package agent
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
 // Config represents the agent configuration
 type Config struct {
-	NomadAddr  string        `json:"nomad_addr"`
-	NomadToken string        `json:"nomad_token"`
-	Sinks      []string      `json:"sinks"`
-	EventTypes []string      `json:"event_types"`
-	RateLimit  time.Duration `json:"rate_limit"`
-	FileConfig FileConfig    `json:"file_config"`
+	NomadAddr           string              `json:"nomad_addr"`
+	NomadToken          string              `json:"nomad_token"`
+	Sinks               []string            `json:"sinks"`
+	EventTypes          []string            `json:"event_types"`
+	RateLimit           time.Duration       `json:"rate_limit"`
+	FileConfig          FileConfig          `json:"file_config"`
+	StreamConfig        StreamConfig        `json:"stream_config"`
+	ChangeFields        []string            `json:"change_fields"`
+	Namespaces          []string            `json:"namespaces"`
+	Clusters            []ClusterConfig     `json:"clusters"`
+	CheckpointConfig    CheckpointConfig    `json:"checkpoint_config"`
+	InitialState        string              `json:"initial_state"`
+	HAConfig            HAConfig            `json:"ha_config"`
+	WebhookConfig       WebhookConfig       `json:"webhook_config"`
+	KafkaConfig         KafkaConfig         `json:"kafka_config"`
+	SyslogConfig        SyslogConfig        `json:"syslog_config"`
+	ElasticsearchConfig ElasticsearchConfig `json:"elasticsearch_config"`
+	LokiConfig          LokiConfig          `json:"loki_config"`
+	SplunkHECConfig     SplunkHECConfig     `json:"splunk_hec_config"`
+	S3Config            S3Config            `json:"s3_config"`
+	SQLConfig           SQLConfig           `json:"sql_config"`
+	RedisConfig         RedisConfig         `json:"redis_config"`
+	AMQPConfig          AMQPConfig          `json:"amqp_config"`
+	OTLPConfig          OTLPConfig          `json:"otlp_config"`
+	ChatConfig          ChatConfig          `json:"chat_config"`
+	IncidentConfig      IncidentConfig      `json:"incident_config"`
+	MetricsConfig       MetricsConfig       `json:"metrics_config"`
+}
+
+// CheckpointConfig holds configuration for the checkpoint store
+type CheckpointConfig struct {
+	Store        string `json:"store"`
+	Path         string `json:"path"`
+	VariablePath string `json:"variable_path"`
+}
+
+// HAConfig holds configuration for high-availability mode
+type HAConfig struct {
+	Enabled   bool          `json:"enabled"`
+	LockPath  string        `json:"lock_path"`
+	TTL       time.Duration `json:"ttl"`
+	LockDelay time.Duration `json:"lock_delay"`
+}
+
+// ClusterConfig holds the connection settings for a single Nomad cluster
+type ClusterConfig struct {
+	Label   string    `json:"label"`
+	Address string    `json:"address"`
+	Token   string    `json:"token"`
+	Region  string    `json:"region"`
+	TLS     TLSConfig `json:"tls"`
+}
+
+// TLSConfig holds TLS settings for connecting to a Nomad cluster
+type TLSConfig struct {
+	CACert     string `json:"ca_cert"`
+	ClientCert string `json:"client_cert"`
+	ClientKey  string `json:"client_key"`
+	ServerName string `json:"server_name"`
+	Insecure   bool   `json:"insecure"`
 }
 
 // FileConfig holds configuration for file sink
 type FileConfig struct {
 	Path string `json:"path"`
+
+	// Rotation is disabled unless a size or interval is set
+	RotateSize     int64         `json:"rotate_size"`
+	RotateInterval time.Duration `json:"rotate_interval"`
+	Compress       bool          `json:"compress"`
+
+	// Rotated files are kept forever unless a count or age is set
+	MaxFiles int           `json:"max_files"`
+	MaxAge   time.Duration `json:"max_age"`
+
+	// Files of templated paths are kept open in a bounded pool
+	MaxOpenFiles int           `json:"max_open_files"`
+	IdleTimeout  time.Duration `json:"idle_timeout"`
+}
+
+// WebhookConfig holds configuration for the webhook sink
+type WebhookConfig struct {
+	URL             string            `json:"url"`
+	Headers         map[string]string `json:"headers"`
+	Secret          string            `json:"secret"`
+	SignatureHeader string            `json:"signature_header"`
+	Timeout         time.Duration     `json:"timeout"`
+	Batch           BatchConfig       `json:"batch"`
+	Retry           RetryConfig       `json:"retry"`
+}
+
+// KafkaConfig holds configuration for the Kafka sink
+type KafkaConfig struct {
+	Brokers      []string        `json:"brokers"`
+	Topic        string          `json:"topic"`
+	PartitionKey string          `json:"partition_key"`
+	ClientID     string          `json:"client_id"`
+	Acks         string          `json:"acks"`
+	Compression  string          `json:"compression"`
+	Idempotent   bool            `json:"idempotent"`
+	TLS          SinkTLSConfig   `json:"tls"`
+	SASL         KafkaSASLConfig `json:"sasl"`
+}
+
+// KafkaSASLConfig holds SASL authentication settings for the Kafka sink
+type KafkaSASLConfig struct {
+	Mechanism string `json:"mechanism"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+}
+
+// SyslogConfig holds configuration for the syslog sink
+type SyslogConfig struct {
+	Network  string        `json:"network"`
+	Address  string        `json:"address"`
+	AppName  string        `json:"app_name"`
+	Facility string        `json:"facility"`
+	Hostname string        `json:"hostname"`
+	TLS      SinkTLSConfig `json:"tls"`
+}
+
+// ElasticsearchConfig holds configuration for the Elasticsearch sink
+type ElasticsearchConfig struct {
+	URL        string        `json:"url"`
+	Index      string        `json:"index"`
+	Username   string        `json:"username"`
+	Password   string        `json:"password"`
+	APIKey     string        `json:"api_key"`
+	DocumentID bool          `json:"document_id"`
+	Timeout    time.Duration `json:"timeout"`
+	TLS        SinkTLSConfig `json:"tls"`
+	Batch      BatchConfig   `json:"batch"`
+	Retry      RetryConfig   `json:"retry"`
+}
+
+// LokiConfig holds configuration for the Loki sink
+type LokiConfig struct {
+	URL          string            `json:"url"`
+	Labels       []string          `json:"labels"`
+	StaticLabels map[string]string `json:"static_labels"`
+	TenantID     string            `json:"tenant_id"`
+	Username     string            `json:"username"`
+	Password     string            `json:"password"`
+	Timeout      time.Duration     `json:"timeout"`
+	Batch        BatchConfig       `json:"batch"`
+	Retry        RetryConfig       `json:"retry"`
+}
+
+// SplunkHECConfig holds configuration for the Splunk HEC sink
+type SplunkHECConfig struct {
+	URL        string                     `json:"url"`
+	Token      string                     `json:"token"`
+	Index      string                     `json:"index"`
+	Source     string                     `json:"source"`
+	SourceType string                     `json:"sourcetype"`
+	EventTypes map[string]SplunkHECTarget `json:"event_types"`
+	Ack        bool                       `json:"ack"`
+	AckTimeout time.Duration              `json:"ack_timeout"`
+	Timeout    time.Duration              `json:"timeout"`
+	TLS        SinkTLSConfig              `json:"tls"`
+	Batch      BatchConfig                `json:"batch"`
+	Retry      RetryConfig                `json:"retry"`
+}
+
+// SplunkHECTarget overrides the index, source and sourcetype of an event type
+type SplunkHECTarget struct {
+	Index      string `json:"index"`
+	Source     string `json:"source"`
+	SourceType string `json:"sourcetype"`
+}
+
+// S3Config holds configuration for the S3 sink
+type S3Config struct {
+	Endpoint      string        `json:"endpoint"`
+	Region        string        `json:"region"`
+	Bucket        string        `json:"bucket"`
+	Prefix        string        `json:"prefix"`
+	AccessKey     string        `json:"access_key"`
+	SecretKey     string        `json:"secret_key"`
+	SessionToken  string        `json:"session_token"`
+	PathStyle     bool          `json:"path_style"`
+	Compression   string        `json:"compression"`
+	FlushSize     int64         `json:"flush_size"`
+	FlushInterval time.Duration `json:"flush_interval"`
+	PartSize      int64         `json:"part_size"`
+	Retry         RetryConfig   `json:"retry"`
+}
+
+// SQLConfig holds configuration for the SQL sink
+type SQLConfig struct {
+	Driver string      `json:"driver"`
+	DSN    string      `json:"dsn"`
+	Table  string      `json:"table"`
+	Batch  BatchConfig `json:"batch"`
+}
+
+// RedisConfig holds configuration for the Redis Streams sink
+type RedisConfig struct {
+	Address         string        `json:"address"`
+	Username        string        `json:"username"`
+	Password        string        `json:"password"`
+	DB              int           `json:"db"`
+	Stream          string        `json:"stream"`
+	MaxLen          int64         `json:"max_len"`
+	ApproximateTrim bool          `json:"approximate_trim"`
+	TLS             SinkTLSConfig `json:"tls"`
+	Batch           BatchConfig   `json:"batch"`
+}
+
+// AMQPConfig holds configuration for the AMQP 0.9.1 sink
+type AMQPConfig struct {
+	URL             string        `json:"url"`
+	Exchange        string        `json:"exchange"`
+	ExchangeType    string        `json:"exchange_type"`
+	DeclareExchange bool          `json:"declare_exchange"`
+	RoutingKey      string        `json:"routing_key"`
+	ConfirmTimeout  time.Duration `json:"confirm_timeout"`
+	TLS             SinkTLSConfig `json:"tls"`
+	Retry           RetryConfig   `json:"retry"`
+}
+
+// OTLPConfig holds configuration for the OpenTelemetry OTLP logs sink
+type OTLPConfig struct {
+	Protocol    string            `json:"protocol"`
+	Endpoint    string            `json:"endpoint"`
+	Headers     map[string]string `json:"headers"`
+	ServiceName string            `json:"service_name"`
+	Timeout     time.Duration     `json:"timeout"`
+	QueueSize   int               `json:"queue_size"`
+	TLS         SinkTLSConfig     `json:"tls"`
+	Batch       BatchConfig       `json:"batch"`
+	Retry       RetryConfig       `json:"retry"`
+}
+
+// ChatConfig holds configuration for the chat notification sink
+type ChatConfig struct {
+	Targets []ChatTarget  `json:"targets"`
+	Timeout time.Duration `json:"timeout"`
+	Retry   RetryConfig   `json:"retry"`
+}
+
+// ChatTarget is an incoming webhook that selected events are posted to
+type ChatTarget struct {
+	Name     string      `json:"name"`
+	Provider string      `json:"provider"`
+	URL      string      `json:"url"`
+	Template string      `json:"template"`
+	Filter   EventFilter `json:"filter"`
+}
+
+// IncidentConfig holds configuration for the PagerDuty and Opsgenie
+// incident sink
+type IncidentConfig struct {
+	Provider string         `json:"provider"`
+	URL      string         `json:"url"`
+	Key      string         `json:"key"`
+	Rules    []IncidentRule `json:"rules"`
+	Timeout  time.Duration  `json:"timeout"`
+	Retry    RetryConfig    `json:"retry"`
+}
+
+// IncidentRule triggers an alert for events matching Trigger and resolves
+// it for events about the same object matching Resolve
+type IncidentRule struct {
+	Name     string      `json:"name"`
+	Severity string      `json:"severity"`
+	Summary  string      `json:"summary"`
+	Key      string      `json:"key"`
+	Trigger  EventFilter `json:"trigger"`
+	Resolve  EventFilter `json:"resolve"`
+}
+
+// MetricsConfig holds configuration for the Prometheus metrics endpoint
+type MetricsConfig struct {
+	Enabled   bool     `json:"enabled"`
+	Address   string   `json:"address"`
+	Path      string   `json:"path"`
+	Labels    []string `json:"labels"`
+	MaxSeries int      `json:"max_series"`
+}
+
+// SinkTLSConfig holds TLS settings for connecting to a sink
+type SinkTLSConfig struct {
+	Enabled    bool   `json:"enabled"`
+	CACert     string `json:"ca_cert"`
+	ClientCert string `json:"client_cert"`
+	ClientKey  string `json:"client_key"`
+	ServerName string `json:"server_name"`
+	Insecure   bool   `json:"insecure"`
+}
+
+// BatchConfig holds the batching settings shared by network sinks
+type BatchConfig struct {
+	Size     int           `json:"size"`
+	Interval time.Duration `json:"interval"`
+}
+
+// RetryConfig holds the retry settings shared by network sinks
+type RetryConfig struct {
+	MaxRetries     int           `json:"max_retries"`
+	InitialBackoff time.Duration `json:"initial_backoff"`
+	MaxBackoff     time.Duration `json:"max_backoff"`
+}
+
+// StreamConfig holds configuration for the event stream manager
+type StreamConfig struct {
+	Topics []string `json:"topics"`
+	Index  uint64   `json:"index"`
 }
 
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
-	if c.NomadAddr == "" {
+	if len(c.Clusters) == 0 && c.NomadAddr == "" {
 		return fmt.Errorf("nomad address is required")
 	}
 
+	labels := make(map[string]bool, len(c.Clusters))
+	for _, cluster := range c.Clusters {
+		if cluster.Address == "" {
+			return fmt.Errorf("address is required for cluster %q", cluster.Label)
+		}
+
+		if len(c.Clusters) > 1 && cluster.Label == "" {
+			return fmt.Errorf("label is required for every cluster when multiple clusters are configured")
+		}
+
+		if labels[cluster.Label] {
+			return fmt.Errorf("duplicate cluster label: %s", cluster.Label)
+		}
+		labels[cluster.Label] = true
+	}
+
 	if len(c.Sinks) == 0 {
 		return fmt.Errorf("at least one sink must be specified")
 	}
@@ -38,11 +352,294 @@ func (c *Config) Validate() error {
 			if c.FileConfig.Path == "" {
 				return fmt.Errorf("file path is required when using file sink")
 			}
+			if c.FileConfig.RotateSize < 0 || c.FileConfig.RotateInterval < 0 {
+				return fmt.Errorf("file rotation size and interval must not be negative")
+			}
+			if c.FileConfig.MaxFiles < 0 || c.FileConfig.MaxAge < 0 {
+				return fmt.Errorf("file retention count and age must not be negative")
+			}
+			if c.FileConfig.MaxOpenFiles < 0 || c.FileConfig.IdleTimeout < 0 {
+				return fmt.Errorf("file max open files and idle timeout must not be negative")
+			}
+		case "webhook":
+			if c.WebhookConfig.URL == "" {
+				return fmt.Errorf("webhook url is required when using webhook sink")
+			}
+			if err := c.WebhookConfig.Batch.Validate(); err != nil {
+				return fmt.Errorf("invalid webhook batch configuration: %w", err)
+			}
+			if err := c.WebhookConfig.Retry.Validate(); err != nil {
+				return fmt.Errorf("invalid webhook retry configuration: %w", err)
+			}
+		case "kafka":
+			if len(c.KafkaConfig.Brokers) == 0 {
+				return fmt.Errorf("kafka brokers are required when using kafka sink")
+			}
+			if c.KafkaConfig.Topic == "" {
+				return fmt.Errorf("kafka topic is required when using kafka sink")
+			}
+			if err := ValidateEventTemplate(c.KafkaConfig.PartitionKey); err != nil {
+				return fmt.Errorf("invalid kafka partition key: %w", err)
+			}
+		case "syslog":
+			if c.SyslogConfig.Address == "" {
+				return fmt.Errorf("syslog address is required when using syslog sink")
+			}
+			switch c.SyslogConfig.Network {
+			case SyslogNetworkUDP, SyslogNetworkTCP, SyslogNetworkTLS, SyslogNetworkUnix:
+			default:
+				return fmt.Errorf("unknown syslog network: %s", c.SyslogConfig.Network)
+			}
+			if _, ok := syslogFacilities[c.SyslogConfig.Facility]; !ok && c.SyslogConfig.Facility != "" {
+				return fmt.Errorf("unknown syslog facility: %s", c.SyslogConfig.Facility)
+			}
+		case "elasticsearch":
+			if c.ElasticsearchConfig.URL == "" {
+				return fmt.Errorf("elasticsearch url is required when using elasticsearch sink")
+			}
+			if err := ValidateEventTemplate(c.ElasticsearchConfig.Index, "date"); err != nil {
+				return fmt.Errorf("invalid elasticsearch index: %w", err)
+			}
+			if err := c.ElasticsearchConfig.Batch.Validate(); err != nil {
+				return fmt.Errorf("invalid elasticsearch batch configuration: %w", err)
+			}
+			if err := c.ElasticsearchConfig.Retry.Validate(); err != nil {
+				return fmt.Errorf("invalid elasticsearch retry configuration: %w", err)
+			}
+		case "loki":
+			if c.LokiConfig.URL == "" {
+				return fmt.Errorf("loki url is required when using loki sink")
+			}
+			if err := validateLokiLabels(c.LokiConfig); err != nil {
+				return err
+			}
+			if err := c.LokiConfig.Batch.Validate(); err != nil {
+				return fmt.Errorf("invalid loki batch configuration: %w", err)
+			}
+			if err := c.LokiConfig.Retry.Validate(); err != nil {
+				return fmt.Errorf("invalid loki retry configuration: %w", err)
+			}
+		case "splunk_hec":
+			if c.SplunkHECConfig.URL == "" {
+				return fmt.Errorf("splunk hec url is required when using splunk_hec sink")
+			}
+			if c.SplunkHECConfig.Token == "" {
+				return fmt.Errorf("splunk hec token is required when using splunk_hec sink")
+			}
+			if err := validateSplunkHECTemplates(c.SplunkHECConfig); err != nil {
+				return fmt.Errorf("invalid splunk hec configuration: %w", err)
+			}
+			if err := c.SplunkHECConfig.Batch.Validate(); err != nil {
+				return fmt.Errorf("invalid splunk hec batch configuration: %w", err)
+			}
+			if err := c.SplunkHECConfig.Retry.Validate(); err != nil {
+				return fmt.Errorf("invalid splunk hec retry configuration: %w", err)
+			}
+		case "s3":
+			if c.S3Config.Bucket == "" {
+				return fmt.Errorf("s3 bucket is required when using s3 sink")
+			}
+			switch c.S3Config.Compression {
+			case "", "gzip", "zstd", "none":
+			default:
+				return fmt.Errorf("unknown s3 compression: %s", c.S3Config.Compression)
+			}
+			// S3 requires every part but the last to be at least 5 MiB
+			if c.S3Config.PartSize != 0 && c.S3Config.PartSize < 5<<20 {
+				return fmt.Errorf("s3 part size must be at least 5MiB")
+			}
+		case "sql":
+			switch c.SQLConfig.Driver {
+			case SQLDriverPostgres, SQLDriverSQLite:
+			default:
+				return fmt.Errorf("unknown sql driver: %s", c.SQLConfig.Driver)
+			}
+			if c.SQLConfig.DSN == "" {
+				return fmt.Errorf("sql dsn is required when using sql sink")
+			}
+			if c.SQLConfig.Table != "" && !sqlIdentifierPattern.MatchString(c.SQLConfig.Table) {
+				return fmt.Errorf("invalid sql table name: %s", c.SQLConfig.Table)
+			}
+			if err := c.SQLConfig.Batch.Validate(); err != nil {
+				return fmt.Errorf("invalid sql batch configuration: %w", err)
+			}
+		case "redis":
+			if c.RedisConfig.Address == "" {
+				return fmt.Errorf("redis address is required when using redis sink")
+			}
+			if err := ValidateEventTemplate(c.RedisConfig.Stream); err != nil {
+				return fmt.Errorf("invalid redis stream: %w", err)
+			}
+			if c.RedisConfig.MaxLen < 0 {
+				return fmt.Errorf("redis max length must not be negative")
+			}
+			if err := c.RedisConfig.Batch.Validate(); err != nil {
+				return fmt.Errorf("invalid redis batch configuration: %w", err)
+			}
+		case "amqp":
+			if c.AMQPConfig.URL == "" {
+				return fmt.Errorf("amqp url is required when using amqp sink")
+			}
+			if c.AMQPConfig.Exchange == "" {
+				return fmt.Errorf("amqp exchange is required when using amqp sink")
+			}
+			if c.AMQPConfig.ExchangeType != "" && !amqpExchangeTypes[c.AMQPConfig.ExchangeType] {
+				return fmt.Errorf("unknown amqp exchange type: %s", c.AMQPConfig.ExchangeType)
+			}
+			if err := ValidateEventTemplate(c.AMQPConfig.RoutingKey); err != nil {
+				return fmt.Errorf("invalid amqp routing key: %w", err)
+			}
+			if err := c.AMQPConfig.Retry.Validate(); err != nil {
+				return fmt.Errorf("invalid amqp retry configuration: %w", err)
+			}
+		case "otlp":
+			if c.OTLPConfig.Endpoint == "" {
+				return fmt.Errorf("otlp endpoint is required when using otlp sink")
+			}
+			switch c.OTLPConfig.Protocol {
+			case "", OTLPProtocolGRPC, OTLPProtocolHTTP:
+			default:
+				return fmt.Errorf("unknown otlp protocol: %s", c.OTLPConfig.Protocol)
+			}
+			if c.OTLPConfig.QueueSize < 0 {
+				return fmt.Errorf("otlp queue size must not be negative")
+			}
+			if err := c.OTLPConfig.Batch.Validate(); err != nil {
+				return fmt.Errorf("invalid otlp batch configuration: %w", err)
+			}
+			if err := c.OTLPConfig.Retry.Validate(); err != nil {
+				return fmt.Errorf("invalid otlp retry configuration: %w", err)
+			}
+		case "chat":
+			if len(c.ChatConfig.Targets) == 0 {
+				return fmt.Errorf("at least one chat target is required when using chat sink")
+			}
+			for i, target := range c.ChatConfig.Targets {
+				if target.Name == "" {
+					return fmt.Errorf("chat target %d has no name", i)
+				}
+				switch target.Provider {
+				case ChatProviderSlack, ChatProviderMattermost, ChatProviderDiscord:
+				default:
+					return fmt.Errorf("chat target %s has unknown provider %q", target.Name, target.Provider)
+				}
+				if target.URL == "" {
+					return fmt.Errorf("chat target %s has no url", target.Name)
+				}
+				if err := target.Filter.Validate(); err != nil {
+					return fmt.Errorf("chat target %s has an invalid filter: %w", target.Name, err)
+				}
+			}
+			if err := c.ChatConfig.Retry.Validate(); err != nil {
+				return fmt.Errorf("invalid chat retry configuration: %w", err)
+			}
+		case "incident":
+			switch c.IncidentConfig.Provider {
+			case IncidentProviderPagerDuty, IncidentProviderOpsgenie:
+			default:
+				return fmt.Errorf("unknown incident provider: %s", c.IncidentConfig.Provider)
+			}
+			if c.IncidentConfig.Key == "" {
+				return fmt.Errorf("incident integration key is required when using incident sink")
+			}
+			for i, rule := range c.IncidentConfig.Rules {
+				if rule.Name == "" {
+					return fmt.Errorf("incident rule %d has no name", i)
+				}
+				if _, ok := incidentSeverities[rule.Severity]; rule.Severity != "" && !ok {
+					return fmt.Errorf("incident rule %s has unknown severity %q", rule.Name, rule.Severity)
+				}
+				if rule.Key != "" && !isEventField(rule.Key) {
+					return fmt.Errorf("incident rule %s has unknown key field %q", rule.Name, rule.Key)
+				}
+				if rule.Trigger.isEmpty() {
+					return fmt.Errorf("incident rule %s has an empty trigger", rule.Name)
+				}
+				if err := rule.Trigger.Validate(); err != nil {
+					return fmt.Errorf("incident rule %s has an invalid trigger: %w", rule.Name, err)
+				}
+				if err := rule.Resolve.Validate(); err != nil {
+					return fmt.Errorf("incident rule %s has an invalid resolve filter: %w", rule.Name, err)
+				}
+			}
+			if err := c.IncidentConfig.Retry.Validate(); err != nil {
+				return fmt.Errorf("invalid incident retry configuration: %w", err)
+			}
 		default:
 			return fmt.Errorf("unknown sink type: %s", sink)
 		}
 	}
 
+	for _, namespace := range c.Namespaces {
+		if namespace == "" {
+			return fmt.Errorf("namespace names must not be empty")
+		}
+	}
+
+	switch c.InitialState {
+	case "", InitialStateSkip, InitialStateEmit, InitialStateEmitOnce:
+	default:
+		return fmt.Errorf("unknown initial state mode: %s", c.InitialState)
+	}
+
+	switch c.CheckpointConfig.Store {
+	case "", "none":
+		// Checkpointing disabled
+	case "file":
+		if c.CheckpointConfig.Path == "" {
+			return fmt.Errorf("checkpoint path is required when using file checkpoint store")
+		}
+	case "nomad":
+		if c.CheckpointConfig.VariablePath == "" {
+			return fmt.Errorf("checkpoint variable path is required when using nomad checkpoint store")
+		}
+	default:
+		return fmt.Errorf("unknown checkpoint store: %s", c.CheckpointConfig.Store)
+	}
+
+	if c.HAConfig.Enabled {
+		if c.HAConfig.LockPath == "" {
+			return fmt.Errorf("lock path is required when high-availability mode is enabled")
+		}
+
+		if c.HAConfig.TTL <= 0 {
+			return fmt.Errorf("lock ttl must be positive when high-availability mode is enabled")
+		}
+
+		if c.HAConfig.LockDelay < 0 {
+			return fmt.Errorf("lock delay must not be negative")
+		}
+
+		// Checkpoints kept on the local host can not be read by a standby
+		// taking over on another one
+		if c.CheckpointConfig.Store != "nomad" {
+			return fmt.Errorf("high-availability mode requires the nomad checkpoint store")
+		}
+
+		// Writing the checkpoints would replace the lock and the other way round
+		if strings.Trim(c.CheckpointConfig.VariablePath, "/") == strings.Trim(c.HAConfig.LockPath, "/") {
+			return fmt.Errorf("checkpoint variable path must differ from the lock path: %s", c.HAConfig.LockPath)
+		}
+	}
+
+	if c.MetricsConfig.Enabled {
+		if err := validateMetricsLabels(c.MetricsConfig.Labels); err != nil {
+			return err
+		}
+
+		if c.MetricsConfig.Path != "" && !strings.HasPrefix(c.MetricsConfig.Path, "/") {
+			return fmt.Errorf("metrics path must start with /")
+		}
+
+		if c.MetricsConfig.MaxSeries < 0 {
+			return fmt.Errorf("metrics max series must not be negative")
+		}
+	}
+
+	if _, err := ParseChangeFields(c.ChangeFields); err != nil {
+		return err
+	}
+
 	// Validate event types if specified
 	if len(c.EventTypes) > 0 {
 		validEventTypes := map[string]bool{
@@ -52,14 +649,58 @@ func (c *Config) Validate() error {
 			EventTypeJob:        true,
 			EventTypeDeployment: true,
 			EventTypeTask:       true,
+			EventTypeStream:     true,
 		}
 
 		for _, eventType := range c.EventTypes {
 			if !validEventTypes[eventType] {
 				return fmt.Errorf("unknown event type: %s", eventType)
 			}
+
+			if eventType == EventTypeStream {
+				if _, err := ParseStreamTopics(c.StreamConfig.Topics); err != nil {
+					return err
+				}
+			}
 		}
 	}
 
 	return nil
 }
+
+// ClusterConfigs returns the clusters to watch, falling back to a single
+// cluster built from NomadAddr and NomadToken when none are configured
+func (c *Config) ClusterConfigs() []ClusterConfig {
+	if len(c.Clusters) > 0 {
+		return c.Clusters
+	}
+
+	return []ClusterConfig{
+		{
+			Address: c.NomadAddr,
+			Token:   c.NomadToken,
+		},
+	}
+}
+
+// Validate checks if the batch configuration is valid
+func (c BatchConfig) Validate() error {
+	if c.Size < 0 {
+		return fmt.Errorf("batch size must not be negative")
+	}
+	if c.Interval < 0 {
+		return fmt.Errorf("batch interval must not be negative")
+	}
+	return nil
+}
+
+// Validate checks if the retry configuration is valid
+func (c RetryConfig) Validate() error {
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("max retries must not be negative")
+	}
+	if c.InitialBackoff < 0 || c.MaxBackoff < 0 {
+		return fmt.Errorf("backoff must not be negative")
+	}
+	return nil
+}
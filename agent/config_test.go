@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfigClusterConfigs(t *testing.T) {
+	config := &Config{
+		NomadAddr:  "http://localhost:4646",
+		NomadToken: "secret",
+	}
+
+	clusters := config.ClusterConfigs()
+	if len(clusters) != 1 {
+		t.Fatalf("Expected 1 cluster, got %d", len(clusters))
+	}
+
+	if clusters[0].Address != "http://localhost:4646" || clusters[0].Token != "secret" {
+		t.Errorf("Expected cluster built from NomadAddr and NomadToken, got %+v", clusters[0])
+	}
+
+	config.Clusters = []ClusterConfig{
+		{Label: "east", Address: "https://east:4646"},
+		{Label: "west", Address: "https://west:4646"},
+	}
+
+	if clusters := config.ClusterConfigs(); len(clusters) != 2 || clusters[1].Label != "west" {
+		t.Errorf("Expected configured clusters, got %+v", clusters)
+	}
+}
+
+func TestConfigValidateClusters(t *testing.T) {
+	tests := []struct {
+		name     string
+		clusters []ClusterConfig
+		wantErr  bool
+	}{
+		{
+			name: "labelled clusters",
+			clusters: []ClusterConfig{
+				{Label: "east", Address: "https://east:4646"},
+				{Label: "west", Address: "https://west:4646"},
+			},
+		},
+		{
+			name: "missing address",
+			clusters: []ClusterConfig{
+				{Label: "east"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing label",
+			clusters: []ClusterConfig{
+				{Label: "east", Address: "https://east:4646"},
+				{Address: "https://west:4646"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate label",
+			clusters: []ClusterConfig{
+				{Label: "east", Address: "https://east:4646"},
+				{Label: "east", Address: "https://west:4646"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				Sinks:    []string{"stdout"},
+				Clusters: tt.clusters,
+			}
+
+			err := config.Validate()
+			if tt.wantErr && err == nil {
+				t.Error("Validate() expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestConfigValidateHA(t *testing.T) {
+	tests := []struct {
+		name         string
+		store        string
+		variablePath string
+		wantErr      bool
+	}{
+		{name: "nomad checkpoint store", store: "nomad"},
+		{name: "file checkpoint store", store: "file", wantErr: true},
+		{name: "checkpointing disabled", store: "none", wantErr: true},
+		{name: "checkpoint variable is the lock", store: "nomad", variablePath: "nomad-event-logger/leader", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			variablePath := tt.variablePath
+			if variablePath == "" {
+				variablePath = "nomad-event-logger/checkpoints"
+			}
+			config := &Config{
+				NomadAddr: "http://localhost:4646",
+				Sinks:     []string{"stdout"},
+				CheckpointConfig: CheckpointConfig{
+					Store:        tt.store,
+					Path:         "/tmp/checkpoints.json",
+					VariablePath: variablePath,
+				},
+				HAConfig: HAConfig{
+					Enabled:  true,
+					LockPath: "nomad-event-logger/leader",
+					TTL:      15 * time.Second,
+				},
+			}
+
+			err := config.Validate()
+			if tt.wantErr && err == nil {
+				t.Error("Validate() expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	nomadapi "github.com/hashicorp/nomad/api"
@@ -11,19 +12,30 @@ import (
 // DeploymentManager manages deployment events
 type DeploymentManager struct {
 	*BaseManager
+	tracker *objectTracker[*nomadapi.Deployment]
 }
 
-func NewDeploymentManager(nomadAddr, nomadToken string, sinks []Sink) (*DeploymentManager, error) {
-	baseManager, err := NewBaseManager(nomadAddr, nomadToken, sinks, EventTypeDeployment, 0) // No rate limit for deployments
+func NewDeploymentManager(config ManagerConfig) (*DeploymentManager, error) {
+	baseManager, err := NewBaseManager(config, EventTypeDeployment, 0) // No rate limit for deployments
 	if err != nil {
 		return nil, err
 	}
 	return &DeploymentManager{
 		BaseManager: baseManager,
+		tracker:     newObjectTracker[*nomadapi.Deployment](),
 	}, nil
 }
 
 func (m *DeploymentManager) Start(ctx context.Context) error {
+	checkpoint := m.restoreCheckpoint()
+	if checkpoint != nil {
+		m.tracker.Restore(checkpoint.Objects, func(id string) *nomadapi.Deployment {
+			namespace, deploymentID, _ := strings.Cut(id, "/")
+			return &nomadapi.Deployment{ID: deploymentID, Namespace: namespace}
+		})
+	}
+	m.prepareFirstRun(checkpoint)
+
 	m.wg.Add(1)
 	go func() {
 		defer m.wg.Done()
@@ -46,13 +58,27 @@ func (m *DeploymentManager) watchDeployments(ctx context.Context) error {
 	}
 
 	// Get deployments with blocking query
-	deployments, meta, err := m.nomadClient.Deployments().List(opts)
+	deployments, meta, err := m.nomadClient.Deployments().List(opts.WithContext(ctx))
 	if err != nil {
 		return fmt.Errorf("failed to get deployments: %w", err)
 	}
 
 	// Process deployments
+	current := make(map[string]*nomadapi.Deployment, len(deployments))
 	for _, deployment := range deployments {
+		// Skip deployments outside of the watched namespaces
+		if !m.watchesNamespace(deployment.Namespace) {
+			continue
+		}
+
+		id := namespacedID(deployment.Namespace, deployment.ID)
+		current[id] = deployment
+
+		// Emit the current state on the first run when requested
+		if m.snapshotPending() {
+			m.writeSnapshotEvent(EventTypeDeployment, deployment)
+		}
+
 		// Skip event output on first run
 		if m.isFirstRun() {
 			continue
@@ -63,7 +89,13 @@ func (m *DeploymentManager) watchDeployments(ctx context.Context) error {
 			continue
 		}
 
-		nomadEvent := NewEvent(EventTypeDeployment, deployment)
+		// Attach the field changes since the previously seen version
+		previous, known := m.tracker.Get(id)
+		nomadEvent := m.newChangeEvent(previous, deployment, known)
+		if nomadEvent == nil {
+			continue
+		}
+
 		if err := m.WriteEvent(nomadEvent); err != nil {
 			m.logger.Error("Failed to write deployment event",
 				"error", err.Error(),
@@ -71,6 +103,11 @@ func (m *DeploymentManager) watchDeployments(ctx context.Context) error {
 		}
 	}
 
+	// Deployments missing from the response have been garbage collected
+	if meta != nil {
+		writeDeletedEvents(m.BaseManager, m.tracker.Sync(current), meta.LastIndex)
+	}
+
 	// Update last index
 	if meta != nil && meta.LastIndex > m.lastIndex {
 		m.lastIndex = meta.LastIndex
@@ -79,5 +116,7 @@ func (m *DeploymentManager) watchDeployments(ctx context.Context) error {
 	// Mark first run as complete after processing
 	m.markFirstRunComplete()
 
+	m.saveCheckpoint(Checkpoint{Index: m.lastIndex, Objects: m.checkpointObjects(m.tracker.IDs)})
+
 	return nil
 }
@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change describes a single field that differs between two versions of an object
+type Change struct {
+	Path string `json:"path"`
+	Old  any    `json:"old"`
+	New  any    `json:"new"`
+}
+
+// Diff compares the JSON representation of two objects and returns every
+// leaf field that changed, ordered by path. Nested fields are joined with
+// dots and list elements are addressed as Field[index].
+func Diff(previous, current any) ([]Change, error) {
+	oldValue, err := toGeneric(previous)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode previous version: %w", err)
+	}
+
+	newValue, err := toGeneric(current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode current version: %w", err)
+	}
+
+	var changes []Change
+	diffValues("", oldValue, newValue, &changes)
+	return changes, nil
+}
+
+// toGeneric converts an object into maps, slices and scalars
+func toGeneric(object any) (any, error) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func diffValues(path string, oldValue, newValue any, changes *[]Change) {
+	oldMap, oldIsMap := oldValue.(map[string]any)
+	newMap, newIsMap := newValue.(map[string]any)
+	if oldIsMap && newIsMap {
+		keys := make([]string, 0, len(oldMap)+len(newMap))
+		for key := range oldMap {
+			keys = append(keys, key)
+		}
+		for key := range newMap {
+			if _, ok := oldMap[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			diffValues(childPath, oldMap[key], newMap[key], changes)
+		}
+		return
+	}
+
+	oldList, oldIsList := oldValue.([]any)
+	newList, newIsList := newValue.([]any)
+	if oldIsList && newIsList {
+		for i := 0; i < max(len(oldList), len(newList)); i++ {
+			var oldItem, newItem any
+			if i < len(oldList) {
+				oldItem = oldList[i]
+			}
+			if i < len(newList) {
+				newItem = newList[i]
+			}
+			diffValues(fmt.Sprintf("%s[%d]", path, i), oldItem, newItem, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		*changes = append(*changes, Change{
+			Path: path,
+			Old:  oldValue,
+			New:  newValue,
+		})
+	}
+}
+
+// ChangesMatchFields reports whether any change touches one of the given
+// fields or a field nested below them
+func ChangesMatchFields(changes []Change, fields []string) bool {
+	for _, change := range changes {
+		for _, field := range fields {
+			if change.Path == field ||
+				strings.HasPrefix(change.Path, field+".") ||
+				strings.HasPrefix(change.Path, field+"[") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseChangeFields parses change field filters in the "type:Field" form
+// into a map of fields keyed by event type
+func ParseChangeFields(filters []string) (map[string][]string, error) {
+	fields := make(map[string][]string)
+
+	for _, filter := range filters {
+		eventType, field, found := strings.Cut(strings.TrimSpace(filter), ":")
+		if !found || eventType == "" || field == "" {
+			return nil, fmt.Errorf("invalid change field filter: %q", filter)
+		}
+
+		switch eventType {
+		case EventTypeJob, EventTypeNode, EventTypeEvaluation, EventTypeDeployment:
+		default:
+			return nil, fmt.Errorf("change fields are not supported for event type: %s", eventType)
+		}
+
+		fields[eventType] = append(fields[eventType], field)
+	}
+
+	return fields, nil
+}
+
+// newChangeEvent creates an event for a new or modified object. Modified
+// objects carry the field changes since their previous version. When the
+// manager only watches specific fields, nil is returned for modifications
+// that do not touch any of them.
+func (m *BaseManager) newChangeEvent(previous, current any, known bool) *Event {
+	nomadEvent := NewEvent(m.eventType, current)
+	if !known {
+		return nomadEvent
+	}
+
+	changes, err := Diff(previous, current)
+	if err != nil {
+		m.logger.Error("Failed to compute changes",
+			"event_type", m.eventType,
+			"error", err.Error(),
+		)
+		return nomadEvent
+	}
+
+	if len(m.changeFields) > 0 && !ChangesMatchFields(changes, m.changeFields) {
+		return nil
+	}
+
+	nomadEvent.Changes = changes
+	return nomadEvent
+}
@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestDiff(t *testing.T) {
+	previous := &api.NodeListStub{
+		ID:                    "node-1",
+		Status:                "ready",
+		SchedulingEligibility: "eligible",
+		Drain:                 false,
+		Address:               "10.0.0.1",
+		NodeResources: &api.NodeResources{
+			Devices: []*api.NodeDeviceResource{},
+		},
+	}
+	current := &api.NodeListStub{
+		ID:                    "node-1",
+		Status:                "down",
+		SchedulingEligibility: "ineligible",
+		Drain:                 false,
+		Address:               "10.0.0.1",
+		NodeResources: &api.NodeResources{
+			Devices: []*api.NodeDeviceResource{
+				{Name: "gpu"},
+			},
+		},
+	}
+
+	changes, err := Diff(previous, current)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+
+	paths := make([]string, 0, len(changes))
+	for _, change := range changes {
+		paths = append(paths, change.Path)
+	}
+
+	expected := []string{"NodeResources.Devices[0]", "SchedulingEligibility", "Status"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Diff() paths = %v, want %v", paths, expected)
+	}
+
+	status := changes[2]
+	if status.Old != "ready" || status.New != "down" {
+		t.Errorf("Expected Status change ready -> down, got %v -> %v", status.Old, status.New)
+	}
+}
+
+func TestChangesMatchFields(t *testing.T) {
+	changes := []Change{
+		{Path: "JobSummary.Summary.web.Running", Old: 1.0, New: 2.0},
+		{Path: "Datacenters[0]", Old: "dc1", New: "dc2"},
+	}
+
+	tests := []struct {
+		fields   []string
+		expected bool
+	}{
+		{fields: []string{"Status"}, expected: false},
+		{fields: []string{"JobSummary"}, expected: true},
+		{fields: []string{"JobSummary.Summary.web.Running"}, expected: true},
+		{fields: []string{"Datacenters"}, expected: true},
+		{fields: []string{"Job"}, expected: false},
+	}
+
+	for _, tt := range tests {
+		if got := ChangesMatchFields(changes, tt.fields); got != tt.expected {
+			t.Errorf("ChangesMatchFields(%v) = %v, want %v", tt.fields, got, tt.expected)
+		}
+	}
+}
+
+func TestParseChangeFields(t *testing.T) {
+	fields, err := ParseChangeFields([]string{"node:Status", "node:SchedulingEligibility", "job:Stop"})
+	if err != nil {
+		t.Fatalf("ParseChangeFields() error = %v", err)
+	}
+
+	expected := map[string][]string{
+		EventTypeNode: {"Status", "SchedulingEligibility"},
+		EventTypeJob:  {"Stop"},
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("ParseChangeFields() = %v, want %v", fields, expected)
+	}
+
+	for _, filter := range []string{"Status", "node:", "task:State"} {
+		if _, err := ParseChangeFields([]string{filter}); err == nil {
+			t.Errorf("ParseChangeFields(%q) expected error", filter)
+		}
+	}
+}
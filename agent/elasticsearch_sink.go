@@ -0,0 +1,262 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// DefaultElasticsearchIndex writes every event type to a daily index
+const DefaultElasticsearchIndex = "nomad-{type}-{date}"
+
+// elasticsearchDateFormat is the format of the {date} index placeholder
+const elasticsearchDateFormat = "2006.01.02"
+
+// ElasticsearchSink writes batches of events through the Elasticsearch or
+// OpenSearch _bulk API
+type ElasticsearchSink struct {
+	config  ElasticsearchConfig
+	client  *http.Client
+	bulkURL string
+	batcher *eventBatcher
+}
+
+// bulkItem is a single document of a bulk request
+type bulkItem struct {
+	action   []byte
+	document []byte
+}
+
+// bulkResponse is the part of the _bulk response needed to find failed items
+type bulkResponse struct {
+	Errors bool                        `json:"errors"`
+	Items  []map[string]bulkItemResult `json:"items"`
+}
+
+type bulkItemResult struct {
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error"`
+}
+
+func NewElasticsearchSink(config ElasticsearchConfig) (*ElasticsearchSink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("elasticsearch url is required")
+	}
+
+	if config.Index == "" {
+		config.Index = DefaultElasticsearchIndex
+	}
+
+	tlsConfig, err := newClientTLSConfig(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	s := &ElasticsearchSink{
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout, Transport: transport},
+		bulkURL: strings.TrimSuffix(config.URL, "/") + "/_bulk",
+	}
+	s.batcher = newEventBatcher("elasticsearch", config.Batch, s.send)
+
+	return s, nil
+}
+
+func (s *ElasticsearchSink) Write(event *Event) error {
+	return s.batcher.Add(event)
+}
+
+func (s *ElasticsearchSink) Accepted() uint64 {
+	return s.batcher.Accepted()
+}
+
+func (s *ElasticsearchSink) Delivered() uint64 {
+	return s.batcher.Delivered()
+}
+
+func (s *ElasticsearchSink) Close() error {
+	return s.batcher.Close()
+}
+
+// send writes a batch of events, retrying the whole request on transient
+// failures and only the items that were rejected temporarily otherwise
+func (s *ElasticsearchSink) send(events []*Event) error {
+	pending := make([]bulkItem, 0, len(events))
+	for _, event := range events {
+		item, err := s.newBulkItem(event)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, item)
+	}
+
+	var rejected []string
+	err := withRetry(s.config.Retry, func() error {
+		retry, failures, err := s.bulk(pending)
+		if err != nil {
+			return err
+		}
+
+		rejected = append(rejected, failures...)
+		pending = retry
+		if len(pending) > 0 {
+			return retryable(fmt.Errorf("%d items were rejected temporarily", len(pending)))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %d events to elasticsearch: %w", len(pending), err)
+	}
+
+	if len(rejected) > 0 {
+		return fmt.Errorf("elasticsearch rejected %d events: %s", len(rejected), rejected[0])
+	}
+
+	return nil
+}
+
+// newBulkItem builds the action and document lines for the event
+func (s *ElasticsearchSink) newBulkItem(event *Event) (bulkItem, error) {
+	document, err := event.ToJSON()
+	if err != nil {
+		return bulkItem{}, fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	// With a document ID derived from the event, items are created instead of
+	// indexed so a retried write that already succeeded is a no-op
+	op := "index"
+	meta := map[string]string{"_index": s.indexName(event)}
+	if s.config.DocumentID {
+		op = "create"
+		meta["_id"], err = documentID(event)
+		if err != nil {
+			return bulkItem{}, err
+		}
+	}
+
+	action, err := json.Marshal(map[string]map[string]string{op: meta})
+	if err != nil {
+		return bulkItem{}, fmt.Errorf("failed to marshal bulk action: %w", err)
+	}
+
+	return bulkItem{action: action, document: document}, nil
+}
+
+// documentID derives the document ID from the fields identifying the change
+// carried by the event, rather than the whole event whose time is when the
+// agent observed it, so an event replayed after a restart keeps its ID
+func documentID(event *Event) (string, error) {
+	identity := []any{event.Type, event.Action, event.Cluster, event.Region}
+	switch object := event.Data.(type) {
+	case *TaskEvent:
+		identity = append(identity, object.AllocationID, object.TaskName)
+		if object.TaskEvent != nil {
+			identity = append(identity, object.TaskEvent.Type, object.TaskEvent.Time)
+		}
+	case *AllocationEvent:
+		identity = append(identity, object.AllocationID, object.ModifyTime, object.Current)
+	case *api.JobListStub:
+		identity = append(identity, object.Namespace, object.ID, object.ModifyIndex)
+	case *api.NodeListStub:
+		identity = append(identity, object.ID, object.ModifyIndex)
+	case *api.Evaluation:
+		identity = append(identity, object.ID, object.ModifyIndex)
+	case *api.Deployment:
+		identity = append(identity, object.ID, object.ModifyIndex)
+	case *api.Event:
+		identity = append(identity, object.Topic, object.Type, object.Key, object.Index)
+	default:
+		// Without known identifying fields, everything but the time is used
+		stable := *event
+		stable.Time = time.Time{}
+		identity = append(identity, &stable)
+	}
+
+	data, err := json.Marshal(identity)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal document id fields: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// indexName expands the index template for the event. The date is the time
+// Nomad recorded the change where known, so a replayed event is written to
+// the same index. Index names must be lowercase.
+func (s *ElasticsearchSink) indexName(event *Event) string {
+	index := strings.ReplaceAll(s.config.Index, "{date}", occurredAt(event).UTC().Format(elasticsearchDateFormat))
+	return strings.ToLower(ExpandEventTemplate(index, event))
+}
+
+// bulk sends the items, returning the items to retry and the errors of the
+// items that were rejected permanently
+func (s *ElasticsearchSink) bulk(items []bulkItem) ([]bulkItem, []string, error) {
+	var body bytes.Buffer
+	for _, item := range items {
+		body.Write(item.action)
+		body.WriteByte('\n')
+		body.Write(item.document)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.bulkURL, &body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	switch {
+	case s.config.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+s.config.APIKey)
+	case s.config.Username != "":
+		req.SetBasicAuth(s.config.Username, s.config.Password)
+	}
+
+	resp, err := doHTTPRequest(s.client, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	var result bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, nil, retryable(fmt.Errorf("failed to decode bulk response: %w", err))
+	}
+
+	if !result.Errors {
+		return nil, nil, nil
+	}
+
+	if len(result.Items) != len(items) {
+		return nil, nil, fmt.Errorf("bulk response has %d items, expected %d", len(result.Items), len(items))
+	}
+
+	var retry []bulkItem
+	var failures []string
+	for i, item := range result.Items {
+		for _, itemResult := range item {
+			switch {
+			case itemResult.Status < 300:
+			case itemResult.Status == http.StatusConflict && s.config.DocumentID:
+				// The document was written by an earlier attempt
+			case itemResult.Status == http.StatusTooManyRequests || itemResult.Status >= 500:
+				retry = append(retry, items[i])
+			default:
+				failures = append(failures, string(itemResult.Error))
+			}
+		}
+	}
+
+	return retry, failures, nil
+}
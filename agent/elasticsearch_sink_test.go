@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestElasticsearchSink(t *testing.T) {
+	type request struct {
+		actions []map[string]map[string]string
+	}
+	var requests []request
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" {
+			t.Errorf("Expected request to /_bulk, got %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "ApiKey secret" {
+			t.Errorf("Expected API key authorization, got %q", got)
+		}
+
+		var req request
+		scanner := bufio.NewScanner(r.Body)
+		for line := 0; scanner.Scan(); line++ {
+			if line%2 == 0 {
+				var action map[string]map[string]string
+				json.Unmarshal(scanner.Bytes(), &action)
+				req.actions = append(req.actions, action)
+			}
+		}
+		requests = append(requests, req)
+
+		// The first request rejects the second item temporarily and the
+		// third permanently
+		var items []string
+		for i := range req.actions {
+			status := http.StatusCreated
+			if len(requests) == 1 && i == 1 {
+				status = http.StatusTooManyRequests
+			}
+			if len(requests) == 1 && i == 2 {
+				status = http.StatusBadRequest
+			}
+			items = append(items, fmt.Sprintf(`{"create":{"status":%d,"error":{"type":"error_%d"}}}`, status, status))
+		}
+		fmt.Fprintf(w, `{"errors":true,"items":[%s]}`, strings.Join(items, ","))
+	}))
+	defer server.Close()
+
+	sink, err := NewElasticsearchSink(ElasticsearchConfig{
+		URL:        server.URL,
+		APIKey:     "secret",
+		DocumentID: true,
+		Batch:      BatchConfig{Size: 3},
+		Retry:      RetryConfig{MaxRetries: 2, InitialBackoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create elasticsearch sink: %v", err)
+	}
+	defer sink.Close()
+
+	timestamp := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	var events []*Event
+	for _, job := range []string{"web", "api", "batch"} {
+		event := NewEvent(EventTypeJob, &api.JobListStub{ID: job})
+		event.Time = timestamp
+		events = append(events, event)
+	}
+
+	err = sink.send(events)
+	if err == nil || !strings.Contains(err.Error(), "error_400") {
+		t.Errorf("Expected the permanently rejected item to be reported, got %v", err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 bulk requests, got %d", len(requests))
+	}
+
+	first := requests[0].actions
+	if len(first) != 3 || first[0]["create"]["_index"] != "nomad-job-2026.10.16" {
+		t.Errorf("Unexpected first request actions: %v", first)
+	}
+
+	// Only the temporarily rejected item is retried, with the same ID
+	retried := requests[1].actions
+	if len(retried) != 1 || retried[0]["create"]["_id"] != first[1]["create"]["_id"] {
+		t.Errorf("Expected only the second item to be retried, got %v", retried)
+	}
+}
+
+func TestElasticsearchSink_IndexName(t *testing.T) {
+	sink, err := NewElasticsearchSink(ElasticsearchConfig{
+		URL:   "http://localhost:9200",
+		Index: "nomad-{cluster}-{type}-{date}",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create elasticsearch sink: %v", err)
+	}
+	defer sink.Close()
+
+	event := NewEvent(EventTypeTask, &TaskEvent{})
+	event.Cluster = "US-East"
+	event.Time = time.Date(2026, 10, 16, 23, 0, 0, 0, time.FixedZone("UTC-5", -5*60*60))
+
+	if got, want := sink.indexName(event), "nomad-us-east-task-2026.10.17"; got != want {
+		t.Errorf("indexName() = %q, want %q", got, want)
+	}
+}
+
+func TestDocumentID(t *testing.T) {
+	newJob := func(modifyIndex uint64) *Event {
+		return NewEvent(EventTypeJob, &api.JobListStub{ID: "web", Namespace: "default", ModifyIndex: modifyIndex})
+	}
+	newTask := func(eventTime int64) *Event {
+		return NewEvent(EventTypeTask, &TaskEvent{
+			AllocationID: "abc123",
+			TaskName:     "server",
+			TaskEvent:    &api.TaskEvent{Type: "Started", Time: eventTime},
+		})
+	}
+
+	tests := []struct {
+		name string
+		a, b *Event
+		same bool
+	}{
+		{name: "replayed job", a: newJob(10), b: newJob(10), same: true},
+		{name: "modified job", a: newJob(10), b: newJob(11)},
+		{name: "replayed task event", a: newTask(100), b: newTask(100), same: true},
+		{name: "later task event", a: newTask(100), b: newTask(200)},
+		{name: "unknown data", a: NewEvent("custom", map[string]any{"id": "x"}), b: NewEvent("custom", map[string]any{"id": "x"}), same: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The replayed event is observed again later
+			tt.b.Time = tt.a.Time.Add(time.Hour)
+
+			a, err := documentID(tt.a)
+			if err != nil {
+				t.Fatalf("documentID() error = %v", err)
+			}
+			b, err := documentID(tt.b)
+			if err != nil {
+				t.Fatalf("documentID() error = %v", err)
+			}
+
+			if (a == b) != tt.same {
+				t.Errorf("Expected same document ID: %v, got %s and %s", tt.same, a, b)
+			}
+		})
+	}
+}
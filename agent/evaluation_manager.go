@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	nomadapi "github.com/hashicorp/nomad/api"
@@ -11,19 +12,30 @@ import (
 // EvaluationManager manages evaluation events
 type EvaluationManager struct {
 	*BaseManager
+	tracker *objectTracker[*nomadapi.Evaluation]
 }
 
-func NewEvaluationManager(nomadAddr, nomadToken string, sinks []Sink) (*EvaluationManager, error) {
-	baseManager, err := NewBaseManager(nomadAddr, nomadToken, sinks, EventTypeEvaluation, 0) // No rate limit for evaluations
+func NewEvaluationManager(config ManagerConfig) (*EvaluationManager, error) {
+	baseManager, err := NewBaseManager(config, EventTypeEvaluation, 0) // No rate limit for evaluations
 	if err != nil {
 		return nil, err
 	}
 	return &EvaluationManager{
 		BaseManager: baseManager,
+		tracker:     newObjectTracker[*nomadapi.Evaluation](),
 	}, nil
 }
 
 func (m *EvaluationManager) Start(ctx context.Context) error {
+	checkpoint := m.restoreCheckpoint()
+	if checkpoint != nil {
+		m.tracker.Restore(checkpoint.Objects, func(id string) *nomadapi.Evaluation {
+			namespace, evaluationID, _ := strings.Cut(id, "/")
+			return &nomadapi.Evaluation{ID: evaluationID, Namespace: namespace}
+		})
+	}
+	m.prepareFirstRun(checkpoint)
+
 	m.wg.Add(1)
 	go func() {
 		defer m.wg.Done()
@@ -47,13 +59,27 @@ func (m *EvaluationManager) watchEvaluations(ctx context.Context) error {
 	}
 
 	// Get evaluations with blocking query
-	evaluations, meta, err := m.nomadClient.Evaluations().List(opts)
+	evaluations, meta, err := m.nomadClient.Evaluations().List(opts.WithContext(ctx))
 	if err != nil {
 		return fmt.Errorf("failed to get evaluations: %w", err)
 	}
 
 	// Process evaluations
+	current := make(map[string]*nomadapi.Evaluation, len(evaluations))
 	for _, eval := range evaluations {
+		// Skip evaluations outside of the watched namespaces
+		if !m.watchesNamespace(eval.Namespace) {
+			continue
+		}
+
+		id := namespacedID(eval.Namespace, eval.ID)
+		current[id] = eval
+
+		// Emit the current state on the first run when requested
+		if m.snapshotPending() {
+			m.writeSnapshotEvent(EventTypeEvaluation, eval)
+		}
+
 		// Skip event output on first run
 		if m.isFirstRun() {
 			continue
@@ -70,7 +96,13 @@ func (m *EvaluationManager) watchEvaluations(ctx context.Context) error {
 			continue
 		}
 
-		nomadEvent := NewEvent(EventTypeEvaluation, eval)
+		// Attach the field changes since the previously seen version
+		previous, known := m.tracker.Get(id)
+		nomadEvent := m.newChangeEvent(previous, eval, known)
+		if nomadEvent == nil {
+			continue
+		}
+
 		if err := m.WriteEvent(nomadEvent); err != nil {
 			m.logger.Error("Failed to write evaluation event",
 				"error", err.Error(),
@@ -78,6 +110,11 @@ func (m *EvaluationManager) watchEvaluations(ctx context.Context) error {
 		}
 	}
 
+	// Evaluations missing from the response have been reaped
+	if meta != nil {
+		writeDeletedEvents(m.BaseManager, m.tracker.Sync(current), meta.LastIndex)
+	}
+
 	// Update last index
 	if meta != nil && meta.LastIndex > m.lastIndex {
 		m.lastIndex = meta.LastIndex
@@ -86,5 +123,7 @@ func (m *EvaluationManager) watchEvaluations(ctx context.Context) error {
 	// Mark first run as complete after processing
 	m.markFirstRunComplete()
 
+	m.saveCheckpoint(Checkpoint{Index: m.lastIndex, Objects: m.checkpointObjects(m.tracker.IDs)})
+
 	return nil
 }
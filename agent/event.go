@@ -9,9 +9,15 @@ import (
 
 // Event represents a Nomad event with metadata
 type Event struct {
-	Time time.Time `json:"time"`
-	Type string    `json:"type"`
-	Data any       `json:"data"`
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Cluster   string    `json:"cluster,omitempty"`
+	Region    string    `json:"region,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Action    string    `json:"action,omitempty"`
+	Index     uint64    `json:"index,omitempty"`
+	Data      any       `json:"data"`
+	Changes   []Change  `json:"changes,omitempty"`
 }
 
 // TaskEvent represents a task event with allocation and task information
@@ -19,6 +25,7 @@ type TaskEvent struct {
 	// Allocation information
 	AllocationName     string `json:"AllocationName"`
 	AllocationID       string `json:"AllocationID"`
+	Namespace          string `json:"Namespace"`
 	NodeID             string `json:"NodeID"`
 	EvalID             string `json:"EvalID"`
 	DesiredStatus      string `json:"DesiredStatus"`
@@ -34,13 +41,101 @@ type TaskEvent struct {
 	TaskInfo  map[string]any `json:"TaskInfo"`
 }
 
+// AllocationState holds the lifecycle fields of an allocation that are
+// compared between polls
+type AllocationState struct {
+	ClientStatus      string                `json:"ClientStatus"`
+	DesiredStatus     string                `json:"DesiredStatus"`
+	DesiredTransition api.DesiredTransition `json:"DesiredTransition"`
+	DeploymentHealthy *bool                 `json:"DeploymentHealthy"`
+}
+
+// AllocationEvent represents an allocation lifecycle transition
+type AllocationEvent struct {
+	// Allocation information
+	AllocationName     string `json:"AllocationName"`
+	AllocationID       string `json:"AllocationID"`
+	Namespace          string `json:"Namespace"`
+	NodeID             string `json:"NodeID"`
+	EvalID             string `json:"EvalID"`
+	DesiredDescription string `json:"DesiredDescription"`
+	ClientDescription  string `json:"ClientDescription"`
+	JobID              string `json:"JobID"`
+	TaskGroup          string `json:"TaskGroup"`
+	ModifyTime         int64  `json:"ModifyTime"`
+
+	// Transition information, Previous is nil for new allocations
+	Previous *AllocationState `json:"Previous"`
+	Current  *AllocationState `json:"Current"`
+}
+
 // NewEvent creates a new event with the current time
 func NewEvent(eventType string, data any) *Event {
 	return &Event{
-		Time: time.Now(),
-		Type: eventType,
-		Data: data,
+		Time:      time.Now(),
+		Type:      eventType,
+		Namespace: eventNamespace(data),
+		Data:      data,
+	}
+}
+
+// eventNamespace returns the namespace of the Nomad object carried by an
+// event, or an empty string for objects that are not namespaced
+func eventNamespace(data any) string {
+	switch object := data.(type) {
+	case *api.JobListStub:
+		return object.Namespace
+	case *api.Evaluation:
+		return object.Namespace
+	case *api.Deployment:
+		return object.Namespace
+	case *api.AllocationListStub:
+		return object.Namespace
+	case *TaskEvent:
+		return object.Namespace
+	case *AllocationEvent:
+		return object.Namespace
+	case *api.Event:
+		// Stream events carry the namespace inside their payload object
+		for _, value := range object.Payload {
+			if payload, ok := value.(map[string]any); ok {
+				if namespace, ok := payload["Namespace"].(string); ok {
+					return namespace
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// occurredAt returns when Nomad recorded the change carried by an event,
+// falling back to the time the agent observed it for objects without a
+// timestamp and for deletions, which Nomad does not timestamp
+func occurredAt(event *Event) time.Time {
+	var nanos int64
+	if event.Action != ActionDeleted {
+		switch object := event.Data.(type) {
+		case *TaskEvent:
+			if object.TaskEvent != nil {
+				nanos = object.TaskEvent.Time
+			}
+		case *AllocationEvent:
+			nanos = object.ModifyTime
+		case *api.AllocationListStub:
+			nanos = object.ModifyTime
+		case *api.JobListStub:
+			nanos = object.SubmitTime
+		case *api.Deployment:
+			nanos = object.ModifyTime
+		case *api.Evaluation:
+			nanos = object.ModifyTime
+		}
+	}
+
+	if nanos > 0 {
+		return time.Unix(0, nanos)
 	}
+	return event.Time
 }
 
 // NewTaskEvent creates a new task event
@@ -48,6 +143,7 @@ func NewTaskEvent(allocation *api.AllocationListStub, taskName string, taskEvent
 	return &TaskEvent{
 		AllocationName:     allocation.Name,
 		AllocationID:       allocation.ID,
+		Namespace:          allocation.Namespace,
 		NodeID:             allocation.NodeID,
 		EvalID:             allocation.EvalID,
 		DesiredStatus:      allocation.DesiredStatus,
@@ -62,6 +158,39 @@ func NewTaskEvent(allocation *api.AllocationListStub, taskName string, taskEvent
 	}
 }
 
+// NewAllocationState extracts the lifecycle fields of an allocation
+func NewAllocationState(allocation *api.AllocationListStub, transition api.DesiredTransition) *AllocationState {
+	state := &AllocationState{
+		ClientStatus:      allocation.ClientStatus,
+		DesiredStatus:     allocation.DesiredStatus,
+		DesiredTransition: transition,
+	}
+
+	if allocation.DeploymentStatus != nil {
+		state.DeploymentHealthy = allocation.DeploymentStatus.Healthy
+	}
+
+	return state
+}
+
+// NewAllocationEvent creates a new allocation lifecycle event
+func NewAllocationEvent(allocation *api.AllocationListStub, previous, current *AllocationState) *AllocationEvent {
+	return &AllocationEvent{
+		AllocationName:     allocation.Name,
+		AllocationID:       allocation.ID,
+		Namespace:          allocation.Namespace,
+		NodeID:             allocation.NodeID,
+		EvalID:             allocation.EvalID,
+		DesiredDescription: allocation.DesiredDescription,
+		ClientDescription:  allocation.ClientDescription,
+		JobID:              allocation.JobID,
+		TaskGroup:          allocation.TaskGroup,
+		ModifyTime:         allocation.ModifyTime,
+		Previous:           previous,
+		Current:            current,
+	}
+}
+
 // ToJSON converts the event to JSON bytes
 func (e *Event) ToJSON() ([]byte, error) {
 	return json.Marshal(e)
@@ -75,4 +204,30 @@ const (
 	EventTypeJob        = "job"
 	EventTypeDeployment = "deployment"
 	EventTypeTask       = "task"
+
+	// EventTypeStream selects the Nomad event stream manager, which emits
+	// events using the type matching each event's topic
+	EventTypeStream = "stream"
+)
+
+// Event actions
+const (
+	// ActionDeleted marks an object that was purged or garbage collected
+	ActionDeleted = "deleted"
+
+	// ActionSnapshot marks the state of an object when the agent started,
+	// as opposed to a live change
+	ActionSnapshot = "snapshot"
+)
+
+// Initial state modes
+const (
+	// InitialStateSkip discards the current state on the first poll
+	InitialStateSkip = "skip"
+
+	// InitialStateEmit emits every current object as a snapshot on the first poll
+	InitialStateEmit = "emit"
+
+	// InitialStateEmitOnce emits a snapshot only when no checkpoint was saved
+	InitialStateEmitOnce = "emit-once"
 )
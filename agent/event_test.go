@@ -5,6 +5,8 @@ import (
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/hashicorp/nomad/api"
 )
 
 func TestNewEvent(t *testing.T) {
@@ -65,3 +67,147 @@ func TestEventToJSON(t *testing.T) {
 		t.Errorf("Expected type 'test', got %v", parsed["type"])
 	}
 }
+
+func TestNewAllocationEvent(t *testing.T) {
+	healthy := true
+	allocation := &api.AllocationListStub{
+		ID:            "alloc-123",
+		Name:          "example.web[0]",
+		JobID:         "example",
+		TaskGroup:     "web",
+		ClientStatus:  "running",
+		DesiredStatus: "run",
+		DeploymentStatus: &api.AllocDeploymentStatus{
+			Healthy: &healthy,
+		},
+	}
+
+	previous := &AllocationState{
+		ClientStatus:  "pending",
+		DesiredStatus: "run",
+	}
+	current := NewAllocationState(allocation, api.DesiredTransition{})
+
+	if current.DeploymentHealthy == nil || !*current.DeploymentHealthy {
+		t.Errorf("Expected deployment health to be true, got %v", current.DeploymentHealthy)
+	}
+
+	event := NewEvent(EventTypeAllocation, NewAllocationEvent(allocation, previous, current))
+
+	jsonData, err := event.ToJSON()
+	if err != nil {
+		t.Fatalf("Failed to marshal event to JSON: %v", err)
+	}
+
+	var parsed struct {
+		Data struct {
+			AllocationID string
+			Previous     map[string]any
+			Current      map[string]any
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(jsonData, &parsed); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+
+	if parsed.Data.AllocationID != "alloc-123" {
+		t.Errorf("Expected allocation ID alloc-123, got %v", parsed.Data.AllocationID)
+	}
+
+	if parsed.Data.Previous["ClientStatus"] != "pending" {
+		t.Errorf("Expected previous client status pending, got %v", parsed.Data.Previous["ClientStatus"])
+	}
+
+	if parsed.Data.Current["ClientStatus"] != "running" {
+		t.Errorf("Expected current client status running, got %v", parsed.Data.Current["ClientStatus"])
+	}
+}
+
+func TestNewEventNamespace(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     any
+		expected string
+	}{
+		{
+			name:     "job stub",
+			data:     &api.JobListStub{ID: "example", Namespace: "web"},
+			expected: "web",
+		},
+		{
+			name:     "node stub is not namespaced",
+			data:     &api.NodeListStub{ID: "node-1"},
+			expected: "",
+		},
+		{
+			name: "stream event payload",
+			data: &api.Event{
+				Topic: api.TopicJob,
+				Payload: map[string]any{
+					"Job": map[string]any{"ID": "example", "Namespace": "batch"},
+				},
+			},
+			expected: "batch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := NewEvent("test", tt.data)
+			if event.Namespace != tt.expected {
+				t.Errorf("Expected namespace %q, got %q", tt.expected, event.Namespace)
+			}
+		})
+	}
+}
+
+func TestOccurredAt(t *testing.T) {
+	observed := time.Unix(1700000100, 0)
+	changed := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name     string
+		data     any
+		action   string
+		expected time.Time
+	}{
+		{
+			name:     "task event time",
+			data:     &TaskEvent{TaskEvent: &api.TaskEvent{Type: "Started", Time: changed.UnixNano()}},
+			expected: changed,
+		},
+		{
+			name:     "allocation modify time",
+			data:     &AllocationEvent{AllocationID: "abc123", ModifyTime: changed.UnixNano()},
+			expected: changed,
+		},
+		{
+			name:     "job submit time",
+			data:     &api.JobListStub{ID: "example", SubmitTime: changed.UnixNano()},
+			expected: changed,
+		},
+		{
+			name:     "deleted job uses the observation time",
+			data:     &api.JobListStub{ID: "example", SubmitTime: changed.UnixNano()},
+			action:   ActionDeleted,
+			expected: observed,
+		},
+		{
+			name:     "node uses the observation time",
+			data:     &api.NodeListStub{ID: "node-1"},
+			expected: observed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := NewEvent("test", tt.data)
+			event.Time = observed
+			event.Action = tt.action
+
+			if got := occurredAt(event); !got.Equal(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package agent
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// Event fields that can be referenced by sink templates and label settings
+const (
+	FieldType       = "type"
+	FieldAction     = "action"
+	FieldCluster    = "cluster"
+	FieldRegion     = "region"
+	FieldNamespace  = "namespace"
+	FieldID         = "id"
+	FieldJob        = "job"
+	FieldNode       = "node"
+	FieldAllocation = "allocation"
+	FieldTaskGroup  = "task_group"
+	FieldTask       = "task"
+	FieldEvaluation = "evaluation"
+	FieldDeployment = "deployment"
+)
+
+// EventFields lists every field supported by Event.Field
+var EventFields = []string{
+	FieldType,
+	FieldAction,
+	FieldCluster,
+	FieldRegion,
+	FieldNamespace,
+	FieldID,
+	FieldJob,
+	FieldNode,
+	FieldAllocation,
+	FieldTaskGroup,
+	FieldTask,
+	FieldEvaluation,
+	FieldDeployment,
+}
+
+// objectFields holds the identifiers of the Nomad object carried by an event
+type objectFields struct {
+	ID         string
+	Job        string
+	Node       string
+	Allocation string
+	TaskGroup  string
+	Task       string
+	Evaluation string
+	Deployment string
+}
+
+// Field returns the value of a well-known event field, or an empty string
+// when the event does not carry it
+func (e *Event) Field(name string) string {
+	switch name {
+	case FieldType:
+		return e.Type
+	case FieldAction:
+		return e.Action
+	case FieldCluster:
+		return e.Cluster
+	case FieldRegion:
+		return e.Region
+	case FieldNamespace:
+		return e.Namespace
+	}
+
+	fields := eventObjectFields(e.Data)
+	switch name {
+	case FieldID:
+		return fields.ID
+	case FieldJob:
+		return fields.Job
+	case FieldNode:
+		return fields.Node
+	case FieldAllocation:
+		return fields.Allocation
+	case FieldTaskGroup:
+		return fields.TaskGroup
+	case FieldTask:
+		return fields.Task
+	case FieldEvaluation:
+		return fields.Evaluation
+	case FieldDeployment:
+		return fields.Deployment
+	}
+	return ""
+}
+
+// eventObjectFields extracts the identifiers of the Nomad object carried by
+// an event
+func eventObjectFields(data any) objectFields {
+	switch object := data.(type) {
+	case *api.JobListStub:
+		return objectFields{ID: object.ID, Job: object.ID}
+	case *api.NodeListStub:
+		return objectFields{ID: object.ID, Node: object.ID}
+	case *api.Evaluation:
+		return objectFields{
+			ID:         object.ID,
+			Job:        object.JobID,
+			Node:       object.NodeID,
+			Evaluation: object.ID,
+			Deployment: object.DeploymentID,
+		}
+	case *api.Deployment:
+		return objectFields{ID: object.ID, Job: object.JobID, Deployment: object.ID}
+	case *api.AllocationListStub:
+		return objectFields{
+			ID:         object.ID,
+			Job:        object.JobID,
+			Node:       object.NodeID,
+			Allocation: object.ID,
+			TaskGroup:  object.TaskGroup,
+			Evaluation: object.EvalID,
+		}
+	case *AllocationEvent:
+		return objectFields{
+			ID:         object.AllocationID,
+			Job:        object.JobID,
+			Node:       object.NodeID,
+			Allocation: object.AllocationID,
+			TaskGroup:  object.TaskGroup,
+			Evaluation: object.EvalID,
+		}
+	case *TaskEvent:
+		return objectFields{
+			ID:         object.AllocationID,
+			Job:        object.JobID,
+			Node:       object.NodeID,
+			Allocation: object.AllocationID,
+			TaskGroup:  object.TaskGroup,
+			Task:       object.TaskName,
+			Evaluation: object.EvalID,
+		}
+	case *api.Event:
+		return streamObjectFields(object)
+	}
+	return objectFields{}
+}
+
+// streamObjectFields extracts the identifiers from the payload of a stream
+// event, which is keyed by the object kind
+func streamObjectFields(event *api.Event) objectFields {
+	fields := objectFields{ID: event.Key}
+
+	for kind, value := range event.Payload {
+		payload, ok := value.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		str := func(key string) string {
+			s, _ := payload[key].(string)
+			return s
+		}
+
+		switch kind {
+		case "Job":
+			fields.Job = str("ID")
+		case "Node":
+			fields.Node = str("ID")
+		case "Allocation":
+			fields.Allocation = str("ID")
+			fields.Job = str("JobID")
+			fields.Node = str("NodeID")
+			fields.TaskGroup = str("TaskGroup")
+			fields.Evaluation = str("EvalID")
+			fields.Deployment = str("DeploymentID")
+		case "Evaluation":
+			fields.Evaluation = str("ID")
+			fields.Job = str("JobID")
+			fields.Node = str("NodeID")
+			fields.Deployment = str("DeploymentID")
+		case "Deployment":
+			fields.Deployment = str("ID")
+			fields.Job = str("JobID")
+		}
+	}
+
+	return fields
+}
+
+// templateFieldPattern matches {field} placeholders in event templates
+var templateFieldPattern = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// ExpandEventTemplate replaces every {field} placeholder in the template
+// with the value of the event field, e.g. "nomad.{type}.{job}"
+func ExpandEventTemplate(template string, event *Event) string {
+	if !strings.Contains(template, "{") {
+		return template
+	}
+
+	return templateFieldPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		return event.Field(placeholder[1 : len(placeholder)-1])
+	})
+}
+
+// ValidateEventTemplate checks that every placeholder in the template names a
+// known event field, allowing the extra placeholders given
+func ValidateEventTemplate(template string, extra ...string) error {
+	for _, match := range templateFieldPattern.FindAllStringSubmatch(template, -1) {
+		if !isEventField(match[1]) && !slices.Contains(extra, match[1]) {
+			return fmt.Errorf("unknown field {%s} in template %q", match[1], template)
+		}
+	}
+	return nil
+}
+
+// isEventField returns whether the name is a field supported by Event.Field
+func isEventField(name string) bool {
+	return slices.Contains(EventFields, name)
+}
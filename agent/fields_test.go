@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestExpandEventTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		event    *Event
+		want     string
+	}{
+		{
+			name:     "job fields",
+			template: "{namespace}/{job}",
+			event:    NewEvent(EventTypeJob, &api.JobListStub{ID: "web", Namespace: "prod"}),
+			want:     "prod/web",
+		},
+		{
+			name:     "task fields",
+			template: "nomad.{type}.{job}.{task_group}.{task}",
+			event: NewEvent(EventTypeTask, &TaskEvent{
+				JobID:     "web",
+				TaskGroup: "frontend",
+				TaskName:  "nginx",
+			}),
+			want: "nomad.task.web.frontend.nginx",
+		},
+		{
+			name:     "stream allocation payload",
+			template: "{node}/{allocation}",
+			event: NewEvent(EventTypeAllocation, &api.Event{
+				Key: "alloc-1",
+				Payload: map[string]any{
+					"Allocation": map[string]any{"ID": "alloc-1", "NodeID": "node-1"},
+				},
+			}),
+			want: "node-1/alloc-1",
+		},
+		{
+			name:     "missing field",
+			template: "{node}-{job}",
+			event:    NewEvent(EventTypeJob, &api.JobListStub{ID: "web"}),
+			want:     "-web",
+		},
+		{
+			name:     "no placeholders",
+			template: "nomad-events",
+			event:    NewEvent(EventTypeJob, &api.JobListStub{ID: "web"}),
+			want:     "nomad-events",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExpandEventTemplate(tt.template, tt.event); got != tt.want {
+				t.Errorf("ExpandEventTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateEventTemplate(t *testing.T) {
+	if err := ValidateEventTemplate("nomad.{type}.{namespace}.{job}"); err != nil {
+		t.Errorf("ValidateEventTemplate() error = %v", err)
+	}
+	if err := ValidateEventTemplate("nomad-{type}-{date}", "date"); err != nil {
+		t.Errorf("ValidateEventTemplate() with extra field error = %v", err)
+	}
+	if err := ValidateEventTemplate("{jobs}"); err == nil {
+		t.Error("ValidateEventTemplate() expected error for unknown field, got nil")
+	}
+}
@@ -0,0 +1,682 @@
+package agent
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+const (
+	// DefaultFileMaxOpenFiles caps the file handles kept open by a file sink
+	// with a templated path
+	DefaultFileMaxOpenFiles = 64
+
+	// DefaultFileIdleTimeout is how long a file of a templated path stays
+	// open without being written to
+	DefaultFileIdleTimeout = 5 * time.Minute
+
+	// fileRotationTimeFormat is the timestamp added to the names of rotated
+	// files. It sorts in rotation order.
+	fileRotationTimeFormat = "2006-01-02T15-04-05.000"
+
+	// fileDateFormat is the default layout of the date template function
+	fileDateFormat = "2006-01-02"
+)
+
+// FileSink writes events to files as JSON lines. The path can be a text
+// template rendered for every event, e.g.
+// /var/log/nomad/{{.Type}}/{{.Namespace}}-{{date}}.jsonl, in which case the
+// sink keeps a bounded pool of open files and closes the ones that went idle.
+//
+// Every file is rotated once it would exceed the rotation size or its first
+// line is older than the rotation interval, and rotated files are optionally compressed
+// and removed once they exceed the retention count or age. Events are always
+// written with a single write, so a rotation never splits a line.
+type FileSink struct {
+	config FileConfig
+
+	// path is the parsed path template, nil when the path is static, and
+	// pattern globs every file it renders
+	path      *template.Template
+	pattern   string
+	staticDir string
+
+	files    map[string]*logFile
+	closed   bool
+	mu       sync.Mutex
+	stopChan chan struct{}
+
+	// wg tracks the idle file closer and the background compression and
+	// cleanup of rotated files, which cleanupMu runs one rotation at a time
+	wg        sync.WaitGroup
+	cleanupMu sync.Mutex
+}
+
+// logFile is an open file of the sink
+type logFile struct {
+	path string
+	file *os.File
+	size int64
+
+	// segmentStart is when the first line of the file was written, zero
+	// while the file is empty. It is read back from the file when it is
+	// opened again, so closing idle files, reopening and restarts do not
+	// delay the interval rotation.
+	segmentStart time.Time
+	lastWrite    time.Time
+}
+
+func NewFileSink(config FileConfig) (*FileSink, error) {
+	if config.MaxOpenFiles <= 0 {
+		config.MaxOpenFiles = DefaultFileMaxOpenFiles
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = DefaultFileIdleTimeout
+	}
+
+	s := &FileSink{
+		config:   config,
+		files:    make(map[string]*logFile),
+		stopChan: make(chan struct{}),
+	}
+
+	// Static paths are opened right away so a bad path fails at startup
+	start := strings.Index(config.Path, "{{")
+	if start < 0 {
+		if _, err := s.handle(config.Path); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	path, err := parseFilePathTemplate(config.Path)
+	if err != nil {
+		return nil, err
+	}
+	s.path = path
+	s.pattern = filePathPattern(path)
+
+	// Rendered paths must stay below the directory preceding the first action
+	s.staticDir = filepath.Dir(config.Path[:start] + "x")
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.runIdleCloser()
+	}()
+
+	return s, nil
+}
+
+// parseFilePathTemplate parses a file path template and checks it renders
+// for an event
+func parseFilePathTemplate(path string) (*template.Template, error) {
+	tmpl, err := template.New("path").Funcs(template.FuncMap{
+		// date formats the current UTC date, e.g. {{date}} or {{date "2006-01"}}
+		"date": func(layout ...string) string {
+			if len(layout) > 0 {
+				return time.Now().UTC().Format(layout[0])
+			}
+			return time.Now().UTC().Format(fileDateFormat)
+		},
+	}).Parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file path template %s: %w", path, err)
+	}
+
+	// Unknown event fields fail here rather than on every write
+	if err := tmpl.Execute(io.Discard, &Event{Data: map[string]any{}}); err != nil {
+		return nil, fmt.Errorf("invalid file path template %s: %w", path, err)
+	}
+
+	return tmpl, nil
+}
+
+// filePathPattern returns a glob matching every path rendered by the
+// template, with a wildcard in place of each template action
+func filePathPattern(tmpl *template.Template) string {
+	var b strings.Builder
+	for _, node := range tmpl.Tree.Root.Nodes {
+		if text, ok := node.(*parse.TextNode); ok {
+			b.WriteString(globEscape(string(text.Text)))
+		} else {
+			b.WriteString("*")
+		}
+	}
+	return b.String()
+}
+
+// renderPath returns the path of the file the event is written to
+func (s *FileSink) renderPath(event *Event) (string, error) {
+	if s.path == nil {
+		return s.config.Path, nil
+	}
+
+	var b strings.Builder
+	if err := s.path.Execute(&b, event); err != nil {
+		return "", fmt.Errorf("failed to render file path: %w", err)
+	}
+	path := filepath.Clean(b.String())
+
+	// Event values such as job IDs must not move the file out of the
+	// configured directory
+	rel, err := filepath.Rel(s.staticDir, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("rendered file path %s is outside of %s", path, s.staticDir)
+	}
+
+	return path, nil
+}
+
+// handle returns the open file for the path, opening it and closing the
+// least recently written file when the pool is full
+func (s *FileSink) handle(path string) (*logFile, error) {
+	if f, ok := s.files[path]; ok {
+		return f, nil
+	}
+
+	if len(s.files) >= s.config.MaxOpenFiles {
+		var oldest *logFile
+		for _, f := range s.files {
+			if oldest == nil || f.lastWrite.Before(oldest.lastWrite) {
+				oldest = f
+			}
+		}
+		if err := s.closeFile(oldest); err != nil {
+			GetLogger().Error("Failed to close least recently written file",
+				"path", oldest.path,
+				"error", err.Error(),
+			)
+		}
+	}
+
+	f := &logFile{path: path}
+	if err := s.open(f); err != nil {
+		return nil, err
+	}
+
+	s.files[path] = f
+	return f, nil
+}
+
+// open opens the file in append mode, creating the directories of templated
+// paths
+func (s *FileSink) open(f *logFile) error {
+	if s.path != nil {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for file %s: %w", f.path, err)
+		}
+	}
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", f.path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat file %s: %w", f.path, err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.segmentStart = time.Time{}
+	if f.size > 0 {
+		f.segmentStart = firstLineTime(f.path, info.ModTime())
+	}
+	f.lastWrite = time.Now()
+	return nil
+}
+
+// firstLineTime returns the time of the first event written to the file,
+// or the fallback when the file does not start with an event
+func firstLineTime(path string, fallback time.Time) time.Time {
+	file, err := os.Open(path)
+	if err != nil {
+		return fallback
+	}
+	defer file.Close()
+
+	var first struct {
+		Time time.Time `json:"time"`
+	}
+	if err := json.NewDecoder(file).Decode(&first); err != nil || first.Time.IsZero() {
+		return fallback
+	}
+	return first.Time
+}
+
+// closeFile closes the file and removes it from the pool
+func (s *FileSink) closeFile(f *logFile) error {
+	delete(s.files, f.path)
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to close file %s: %w", f.path, err)
+	}
+	return nil
+}
+
+func (s *FileSink) Write(event *Event) error {
+	data, err := event.ToJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	line := append(data, '\n')
+
+	path, err := s.renderPath(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("file sink is closed")
+	}
+
+	f, err := s.handle(path)
+	if err != nil {
+		return err
+	}
+
+	if s.rotationDue(f, int64(len(line))) {
+		if err := s.rotate(f); err != nil {
+			// Drop the file so the next write opens it again
+			s.closeFile(f)
+			return err
+		}
+	}
+
+	now := time.Now()
+	if f.size == 0 {
+		f.segmentStart = now
+	}
+
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	f.lastWrite = now
+	if err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+
+	return f.file.Sync()
+}
+
+// rotationDue returns whether the file has to be rotated before a line of
+// the given length is written. Empty files are never rotated, so a line
+// larger than the rotation size is written to a file of its own.
+func (s *FileSink) rotationDue(f *logFile, length int64) bool {
+	if f.size == 0 {
+		return false
+	}
+
+	if s.config.RotateSize > 0 && f.size+length > s.config.RotateSize {
+		return true
+	}
+
+	return s.config.RotateInterval > 0 && time.Since(f.segmentStart) >= s.config.RotateInterval
+}
+
+// rotate renames the file with a timestamp, opens a new file and compresses
+// and cleans up rotated files in the background
+func (s *FileSink) rotate(f *logFile) error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close file %s: %w", f.path, err)
+	}
+	f.file = nil
+
+	rotated := rotatedPath(f.path, time.Now())
+	if err := os.Rename(f.path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate file %s: %w", f.path, err)
+	}
+
+	if err := s.open(f); err != nil {
+		return err
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		s.cleanupMu.Lock()
+		defer s.cleanupMu.Unlock()
+
+		if s.config.Compress {
+			if err := compressFile(rotated); err != nil {
+				GetLogger().Error("Failed to compress rotated file",
+					"path", rotated,
+					"error", err.Error(),
+				)
+			}
+		}
+
+		s.removeExpired(f.path)
+	}()
+
+	return nil
+}
+
+// rotatedPath returns the name of a rotated file, e.g.
+// nomad-events-2026-10-16T13-00-00.000.json for nomad-events.json
+func rotatedPath(path string, now time.Time) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	stamp := now.UTC().Format(fileRotationTimeFormat)
+
+	rotated := base + "-" + stamp + ext
+	for i := 1; fileExists(rotated) || fileExists(rotated+".gz"); i++ {
+		rotated = fmt.Sprintf("%s-%s.%d%s", base, stamp, i, ext)
+	}
+	return rotated
+}
+
+// rotatedFiles returns the rotated files of the path, oldest first
+func rotatedFiles(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+
+	matches, err := filepath.Glob(globEscape(base) + "-*" + globEscape(ext) + "*")
+	if err != nil {
+		return nil, err
+	}
+
+	type rotatedFile struct {
+		path  string
+		stamp string
+		count int
+	}
+
+	var files []rotatedFile
+	for _, match := range matches {
+		// Skip files that are being compressed
+		if strings.HasSuffix(match, ".tmp") {
+			continue
+		}
+
+		stamp := strings.TrimPrefix(match, base+"-")
+		if len(stamp) < len(fileRotationTimeFormat) {
+			continue
+		}
+		if _, err := time.Parse(fileRotationTimeFormat, stamp[:len(fileRotationTimeFormat)]); err != nil {
+			continue
+		}
+
+		// Files rotated within the same millisecond carry a counter
+		file := rotatedFile{path: match, stamp: stamp[:len(fileRotationTimeFormat)]}
+		if rest, ok := strings.CutPrefix(stamp[len(fileRotationTimeFormat):], "."); ok {
+			counter, _, _ := strings.Cut(rest, ".")
+			file.count, _ = strconv.Atoi(counter)
+		}
+		files = append(files, file)
+	}
+
+	slices.SortFunc(files, func(a, b rotatedFile) int {
+		if c := strings.Compare(a.stamp, b.stamp); c != 0 {
+			return c
+		}
+		return a.count - b.count
+	})
+
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.path
+	}
+	return paths, nil
+}
+
+// removeExpired removes files beyond the retention count or age. For a
+// static path these are its rotated files, for a templated path every file
+// the template rendered that is not open, such as the files of past dates.
+func (s *FileSink) removeExpired(path string) {
+	if s.config.MaxFiles <= 0 && s.config.MaxAge <= 0 {
+		return
+	}
+
+	var files []string
+	var err error
+	if s.path == nil {
+		files, err = rotatedFiles(path)
+	} else {
+		// Files must not be opened again while they are being removed
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		files, err = s.closedTemplateFiles()
+	}
+	if err != nil {
+		GetLogger().Error("Failed to list expired files",
+			"path", path,
+			"error", err.Error(),
+		)
+		return
+	}
+
+	for i, file := range files {
+		expired := s.config.MaxFiles > 0 && len(files)-i > s.config.MaxFiles
+		if !expired && s.config.MaxAge > 0 {
+			if info, err := os.Stat(file); err == nil && time.Since(info.ModTime()) > s.config.MaxAge {
+				expired = true
+			}
+		}
+
+		if !expired {
+			continue
+		}
+
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			GetLogger().Error("Failed to remove expired file",
+				"path", file,
+				"error", err.Error(),
+			)
+		}
+	}
+}
+
+// closedTemplateFiles returns the files matching the path template, and
+// their rotated and compressed files, that are not open, oldest first. s.mu
+// must be held.
+func (s *FileSink) closedTemplateFiles() ([]string, error) {
+	ext := filepath.Ext(s.pattern)
+	rotated := strings.TrimSuffix(s.pattern, ext) + "-*" + ext
+
+	type closedFile struct {
+		path    string
+		modTime time.Time
+	}
+
+	seen := make(map[string]bool)
+	var files []closedFile
+	for _, pattern := range []string{s.pattern, rotated, rotated + ".gz"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			if _, open := s.files[match]; open || seen[match] || strings.HasSuffix(match, ".tmp") {
+				continue
+			}
+			seen[match] = true
+
+			info, err := os.Stat(match)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			files = append(files, closedFile{path: match, modTime: info.ModTime()})
+		}
+	}
+
+	slices.SortFunc(files, func(a, b closedFile) int {
+		return a.modTime.Compare(b.modTime)
+	})
+
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.path
+	}
+	return paths, nil
+}
+
+// runIdleCloser periodically closes the files that were not written to
+// within the idle timeout and removes expired files
+func (s *FileSink) runIdleCloser() {
+	ticker := time.NewTicker(s.config.IdleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.closeIdle()
+
+			s.cleanupMu.Lock()
+			s.removeExpired(s.config.Path)
+			s.cleanupMu.Unlock()
+		}
+	}
+}
+
+// closeIdle closes the files that were not written to within the idle timeout
+func (s *FileSink) closeIdle() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.files {
+		if time.Since(f.lastWrite) < s.config.IdleTimeout {
+			continue
+		}
+
+		if err := s.closeFile(f); err != nil {
+			GetLogger().Error("Failed to close idle file",
+				"path", f.path,
+				"error", err.Error(),
+			)
+		}
+	}
+}
+
+// Reopen closes and reopens the files, so events are written to new files
+// after an external tool moved the current ones. Files of templated paths
+// are reopened on their next write.
+func (s *FileSink) Reopen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	var errs []error
+	for _, f := range s.files {
+		if err := s.closeFile(f); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if s.path == nil {
+		if _, err := s.handle(s.config.Path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+
+	var errs []error
+	for _, f := range s.files {
+		if err := s.closeFile(f); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.mu.Unlock()
+
+	close(s.stopChan)
+	s.wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// compressFile gzips the file to path.gz and removes the original
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	// Keep the modification time the retention age is measured from
+	if info, err := src.Stat(); err == nil {
+		os.Chtimes(tmp, info.ModTime(), info.ModTime())
+	}
+
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// fileExists returns whether a file exists at the path
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// globEscape escapes the glob metacharacters in a literal path
+func globEscape(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,475 @@
+package agent
+
+import (
+	"bufio"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// countLines returns the number of lines in a file, decompressing it when
+// it is gzipped
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var scanner *bufio.Scanner
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("Failed to read gzip file %s: %v", path, err)
+		}
+		defer gz.Close()
+		scanner = bufio.NewScanner(gz)
+	} else {
+		scanner = bufio.NewScanner(file)
+	}
+
+	lines := 0
+	for scanner.Scan() {
+		lines++
+	}
+	return lines
+}
+
+func TestFileSink_Rotation(t *testing.T) {
+	event := NewEvent(EventTypeJob, &api.JobListStub{ID: "web", Namespace: "default"})
+	data, err := event.ToJSON()
+	if err != nil {
+		t.Fatalf("Failed to marshal event: %v", err)
+	}
+	lineSize := int64(len(data) + 1)
+
+	tests := []struct {
+		name          string
+		config        FileConfig
+		writes        int
+		wantRotated   int
+		wantLines     int
+		wantExtension string
+	}{
+		{
+			name:          "no rotation",
+			config:        FileConfig{},
+			writes:        5,
+			wantRotated:   0,
+			wantLines:     5,
+			wantExtension: ".json",
+		},
+		{
+			name:          "size rotation",
+			config:        FileConfig{RotateSize: 2 * lineSize},
+			writes:        5,
+			wantRotated:   2,
+			wantLines:     1,
+			wantExtension: ".json",
+		},
+		{
+			name:          "size rotation with compression",
+			config:        FileConfig{RotateSize: 2 * lineSize, Compress: true},
+			writes:        5,
+			wantRotated:   2,
+			wantLines:     1,
+			wantExtension: ".json.gz",
+		},
+		{
+			name:          "size rotation keeps max files",
+			config:        FileConfig{RotateSize: lineSize, MaxFiles: 2},
+			writes:        5,
+			wantRotated:   2,
+			wantLines:     1,
+			wantExtension: ".json",
+		},
+		{
+			name:          "oversized lines get a file of their own",
+			config:        FileConfig{RotateSize: 1},
+			writes:        3,
+			wantRotated:   2,
+			wantLines:     1,
+			wantExtension: ".json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Path = filepath.Join(t.TempDir(), "events.json")
+
+			sink, err := NewFileSink(tt.config)
+			if err != nil {
+				t.Fatalf("NewFileSink() error = %v", err)
+			}
+
+			for i := 0; i < tt.writes; i++ {
+				if err := sink.Write(event); err != nil {
+					t.Fatalf("FileSink.Write() error = %v", err)
+				}
+			}
+
+			if err := sink.Close(); err != nil {
+				t.Fatalf("FileSink.Close() error = %v", err)
+			}
+
+			rotated, err := rotatedFiles(tt.config.Path)
+			if err != nil {
+				t.Fatalf("Failed to list rotated files: %v", err)
+			}
+			if len(rotated) != tt.wantRotated {
+				t.Fatalf("Expected %d rotated files, got %v", tt.wantRotated, rotated)
+			}
+
+			for _, file := range rotated {
+				if !strings.HasSuffix(file, tt.wantExtension) {
+					t.Errorf("Expected rotated file %s to end with %s", file, tt.wantExtension)
+				}
+			}
+
+			if lines := countLines(t, tt.config.Path); lines != tt.wantLines {
+				t.Errorf("Expected %d lines in the current file, got %d", tt.wantLines, lines)
+			}
+		})
+	}
+}
+
+func TestFileSink_RotationInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+
+	sink, err := NewFileSink(FileConfig{Path: path, RotateInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	// The first line was written before the interval elapsed
+	event := NewEvent(EventTypeJob, &api.JobListStub{ID: "web"})
+	event.Time = time.Now().Add(-2 * time.Hour)
+	if err := sink.Write(event); err != nil {
+		t.Fatalf("FileSink.Write() error = %v", err)
+	}
+
+	// Reopening the file does not restart the interval
+	if err := sink.Reopen(); err != nil {
+		t.Fatalf("FileSink.Reopen() error = %v", err)
+	}
+
+	if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: "web"})); err != nil {
+		t.Fatalf("FileSink.Write() error = %v", err)
+	}
+
+	rotated, err := rotatedFiles(path)
+	if err != nil {
+		t.Fatalf("Failed to list rotated files: %v", err)
+	}
+	if len(rotated) != 1 {
+		t.Fatalf("Expected 1 rotated file, got %v", rotated)
+	}
+	if lines := countLines(t, rotated[0]); lines != 1 {
+		t.Errorf("Expected 1 line in the rotated file, got %d", lines)
+	}
+	if lines := countLines(t, path); lines != 1 {
+		t.Errorf("Expected 1 line in the current file, got %d", lines)
+	}
+}
+
+func TestFileSink_MaxAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.json")
+
+	// A rotated file left behind by a previous run
+	old := filepath.Join(dir, "events-2020-01-01T00-00-00.000.json.gz")
+	if err := os.WriteFile(old, nil, 0644); err != nil {
+		t.Fatalf("Failed to create rotated file: %v", err)
+	}
+	modTime := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(old, modTime, modTime); err != nil {
+		t.Fatalf("Failed to age rotated file: %v", err)
+	}
+
+	// Files not matching the rotated file names are never removed
+	unrelated := filepath.Join(dir, "events-backup.json")
+	if err := os.WriteFile(unrelated, nil, 0644); err != nil {
+		t.Fatalf("Failed to create unrelated file: %v", err)
+	}
+	if err := os.Chtimes(unrelated, modTime, modTime); err != nil {
+		t.Fatalf("Failed to age unrelated file: %v", err)
+	}
+
+	sink, err := NewFileSink(FileConfig{Path: path, RotateSize: 1, MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+
+	event := NewEvent(EventTypeJob, &api.JobListStub{ID: "web"})
+	for i := 0; i < 2; i++ {
+		if err := sink.Write(event); err != nil {
+			t.Fatalf("FileSink.Write() error = %v", err)
+		}
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("FileSink.Close() error = %v", err)
+	}
+
+	if fileExists(old) {
+		t.Error("Expected the expired rotated file to be removed")
+	}
+	if !fileExists(unrelated) {
+		t.Error("Expected the unrelated file to be kept")
+	}
+
+	rotated, err := rotatedFiles(path)
+	if err != nil {
+		t.Fatalf("Failed to list rotated files: %v", err)
+	}
+	if len(rotated) != 1 {
+		t.Errorf("Expected 1 rotated file, got %v", rotated)
+	}
+}
+
+func TestFileSink_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.json")
+
+	sink, err := NewFileSink(FileConfig{Path: path})
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	event := NewEvent(EventTypeJob, &api.JobListStub{ID: "web"})
+	if err := sink.Write(event); err != nil {
+		t.Fatalf("FileSink.Write() error = %v", err)
+	}
+
+	// Move the file away like logrotate would
+	moved := filepath.Join(dir, "events.json.1")
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatalf("Failed to move file: %v", err)
+	}
+
+	if err := sink.Reopen(); err != nil {
+		t.Fatalf("FileSink.Reopen() error = %v", err)
+	}
+
+	if err := sink.Write(event); err != nil {
+		t.Fatalf("FileSink.Write() error = %v", err)
+	}
+
+	if lines := countLines(t, moved); lines != 1 {
+		t.Errorf("Expected 1 line in the moved file, got %d", lines)
+	}
+	if lines := countLines(t, path); lines != 1 {
+		t.Errorf("Expected 1 line in the reopened file, got %d", lines)
+	}
+}
+
+func TestFileSink_TemplatedPath(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Now().UTC().Format("2006-01-02")
+
+	sink, err := NewFileSink(FileConfig{
+		Path:         filepath.Join(dir, "{{.Type}}", "{{.Namespace}}-{{date}}.jsonl"),
+		MaxOpenFiles: 2,
+	})
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+
+	events := []*Event{
+		NewEvent(EventTypeJob, &api.JobListStub{ID: "web", Namespace: "default"}),
+		NewEvent(EventTypeJob, &api.JobListStub{ID: "api", Namespace: "default"}),
+		NewEvent(EventTypeJob, &api.JobListStub{ID: "batch", Namespace: "ops"}),
+		NewEvent(EventTypeTask, &TaskEvent{TaskName: "server", Namespace: "default"}),
+	}
+	for _, event := range events {
+		if err := sink.Write(event); err != nil {
+			t.Fatalf("FileSink.Write() error = %v", err)
+		}
+	}
+
+	// The least recently written file was closed to make room
+	sink.mu.Lock()
+	open := len(sink.files)
+	sink.mu.Unlock()
+	if open != 2 {
+		t.Errorf("Expected 2 open files, got %d", open)
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("FileSink.Close() error = %v", err)
+	}
+
+	expected := map[string]int{
+		filepath.Join(dir, "job", "default-"+date+".jsonl"):  2,
+		filepath.Join(dir, "job", "ops-"+date+".jsonl"):      1,
+		filepath.Join(dir, "task", "default-"+date+".jsonl"): 1,
+	}
+	for path, want := range expected {
+		if lines := countLines(t, path); lines != want {
+			t.Errorf("Expected %d lines in %s, got %d", want, path, lines)
+		}
+	}
+}
+
+func TestFileSink_TemplatedPathOutsideDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	sink, err := NewFileSink(FileConfig{Path: filepath.Join(dir, "jobs", `{{.Field "job"}}.jsonl`)})
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: "web"})); err != nil {
+		t.Fatalf("FileSink.Write() error = %v", err)
+	}
+	if !fileExists(filepath.Join(dir, "jobs", "web.jsonl")) {
+		t.Error("Expected the job file to be created")
+	}
+
+	if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: "../../escape"})); err == nil {
+		t.Error("Expected an error for a path outside of the directory")
+	}
+}
+
+func TestFileSink_InvalidTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+	}{
+		{
+			name: "syntax error",
+			path: "/tmp/{{.Type}/events.jsonl",
+		},
+		{
+			name: "unknown event field",
+			path: "/tmp/{{.Job}}/events.jsonl",
+		},
+		{
+			name: "unknown function",
+			path: "/tmp/{{hostname}}/events.jsonl",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewFileSink(FileConfig{Path: tt.path}); err == nil {
+				t.Errorf("Expected an error for path %s", tt.path)
+			}
+		})
+	}
+}
+
+func TestFileSink_CloseIdle(t *testing.T) {
+	dir := t.TempDir()
+
+	sink, err := NewFileSink(FileConfig{
+		Path:        filepath.Join(dir, "{{.Type}}.jsonl"),
+		IdleTimeout: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	for _, eventType := range []string{EventTypeJob, EventTypeNode} {
+		if err := sink.Write(NewEvent(eventType, nil)); err != nil {
+			t.Fatalf("FileSink.Write() error = %v", err)
+		}
+	}
+
+	// Pretend the job file was last written before the idle timeout
+	jobPath := filepath.Join(dir, "job.jsonl")
+	sink.mu.Lock()
+	sink.files[jobPath].lastWrite = time.Now().Add(-2 * time.Hour)
+	sink.mu.Unlock()
+
+	sink.closeIdle()
+
+	sink.mu.Lock()
+	_, jobOpen := sink.files[jobPath]
+	_, nodeOpen := sink.files[filepath.Join(dir, "node.jsonl")]
+	sink.mu.Unlock()
+
+	if jobOpen {
+		t.Error("Expected the idle job file to be closed")
+	}
+	if !nodeOpen {
+		t.Error("Expected the node file to stay open")
+	}
+
+	// Closed files are reopened on their next write
+	if err := sink.Write(NewEvent(EventTypeJob, nil)); err != nil {
+		t.Fatalf("FileSink.Write() error = %v", err)
+	}
+	if lines := countLines(t, jobPath); lines != 2 {
+		t.Errorf("Expected 2 lines in the job file, got %d", lines)
+	}
+}
+
+func TestFileSink_TemplatedRetention(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Now().UTC().Format("2006-01-02")
+
+	// Files of past dates left behind by the sink, oldest first
+	var past []string
+	for i, day := range []string{"2020-01-01", "2020-01-02", "2020-01-03"} {
+		path := filepath.Join(dir, "default-"+day+".jsonl")
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		modTime := time.Now().Add(time.Duration(i-3) * time.Hour)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to age file: %v", err)
+		}
+		past = append(past, path)
+	}
+
+	// Files not matching the template are never removed
+	unrelated := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(unrelated, nil, 0644); err != nil {
+		t.Fatalf("Failed to create unrelated file: %v", err)
+	}
+
+	sink, err := NewFileSink(FileConfig{
+		Path:        filepath.Join(dir, "{{.Namespace}}-{{date}}.jsonl"),
+		MaxFiles:    2,
+		IdleTimeout: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: "web", Namespace: "default"})); err != nil {
+		t.Fatalf("FileSink.Write() error = %v", err)
+	}
+
+	// The open file of the current date does not count towards the limit
+	current := filepath.Join(dir, "default-"+date+".jsonl")
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(current, old, old); err != nil {
+		t.Fatalf("Failed to age file: %v", err)
+	}
+
+	// Retention runs on the idle closer tick
+	sink.removeExpired(sink.config.Path)
+
+	if fileExists(past[0]) {
+		t.Errorf("Expected %s to be removed", past[0])
+	}
+	for _, path := range append(past[1:], current, unrelated) {
+		if !fileExists(path) {
+			t.Errorf("Expected %s to be kept", path)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// EventFilter selects events by type, action, namespace, job and the values
+// of fields in the event data. Every criterion that is set must match; an
+// empty filter matches every event.
+type EventFilter struct {
+	Types      []string `json:"types"`
+	Actions    []string `json:"actions"`
+	Namespaces []string `json:"namespaces"`
+
+	// Jobs are glob patterns matched against the job ID, e.g. web-*
+	Jobs []string `json:"jobs"`
+
+	// Match maps dot-separated paths into the event data to the values they
+	// may have, e.g. TaskEvent.Details.oom_killed: ["true"]
+	Match map[string][]string `json:"match"`
+}
+
+// Validate checks the job patterns and match paths of the filter
+func (f EventFilter) Validate() error {
+	for _, pattern := range f.Jobs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid job pattern %q: %w", pattern, err)
+		}
+	}
+
+	for field, values := range f.Match {
+		if field == "" || strings.HasPrefix(field, ".") || strings.HasSuffix(field, ".") {
+			return fmt.Errorf("invalid match path %q", field)
+		}
+		if len(values) == 0 {
+			return fmt.Errorf("match path %q has no values", field)
+		}
+	}
+
+	return nil
+}
+
+// isEmpty returns whether the filter has no criteria and so matches every event
+func (f EventFilter) isEmpty() bool {
+	return len(f.Types) == 0 && len(f.Actions) == 0 && len(f.Namespaces) == 0 &&
+		len(f.Jobs) == 0 && len(f.Match) == 0
+}
+
+// Matches returns whether the event passes the filter
+func (f EventFilter) Matches(event *Event) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, event.Type) {
+		return false
+	}
+
+	if len(f.Actions) > 0 && !slices.Contains(f.Actions, event.Action) {
+		return false
+	}
+
+	if len(f.Namespaces) > 0 && !slices.Contains(f.Namespaces, event.Namespace) {
+		return false
+	}
+
+	if len(f.Jobs) > 0 && !matchesAnyPattern(f.Jobs, event.Field(FieldJob)) {
+		return false
+	}
+
+	if len(f.Match) > 0 {
+		data, err := eventDataMap(event)
+		if err != nil {
+			return false
+		}
+
+		for field, values := range f.Match {
+			value, ok := lookupPath(data, field)
+			if !ok || !slices.Contains(values, value) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// matchesAnyPattern returns whether the value matches one of the glob patterns
+func matchesAnyPattern(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// eventDataMap returns the event data decoded as generic JSON, so filters
+// see the same field names as the JSON output
+func eventDataMap(event *Event) (map[string]any, error) {
+	encoded, err := json.Marshal(event.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// lookupPath returns the value at the dot-separated path formatted as a
+// string. Field names are matched case-insensitively, as the configuration
+// file loader lowercases them. Missing fields and null values are not found.
+func lookupPath(data map[string]any, fieldPath string) (string, bool) {
+	var value any = data
+	for _, name := range strings.Split(fieldPath, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if value, ok = lookupField(object, name); !ok {
+			return "", false
+		}
+	}
+
+	switch value := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return value, true
+	case bool:
+		return strconv.FormatBool(value), true
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	default:
+		encoded, _ := json.Marshal(value)
+		return string(encoded), true
+	}
+}
+
+// lookupField returns the field of the object, preferring an exact match
+func lookupField(object map[string]any, name string) (any, bool) {
+	if value, ok := object[name]; ok {
+		return value, true
+	}
+
+	for key, value := range object {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestEventFilter_Matches(t *testing.T) {
+	oomKill := NewEvent(EventTypeTask, &TaskEvent{
+		Namespace: "production",
+		JobID:     "web-frontend",
+		TaskEvent: &api.TaskEvent{
+			Type:     api.TaskTerminated,
+			ExitCode: 137,
+			Details:  map[string]string{"oom_killed": "true"},
+		},
+	})
+	failedDeployment := NewEvent(EventTypeDeployment, &api.Deployment{
+		Namespace: "default",
+		JobID:     "api",
+		Status:    api.DeploymentStatusFailed,
+	})
+	deletedJob := NewEvent(EventTypeJob, &api.JobListStub{ID: "batch", Namespace: "default"})
+	deletedJob.Action = ActionDeleted
+
+	tests := []struct {
+		name   string
+		filter EventFilter
+		event  *Event
+		want   bool
+	}{
+		{"empty filter", EventFilter{}, deletedJob, true},
+		{"type", EventFilter{Types: []string{EventTypeDeployment}}, failedDeployment, true},
+		{"other type", EventFilter{Types: []string{EventTypeNode}}, failedDeployment, false},
+		{"action", EventFilter{Actions: []string{ActionDeleted}}, deletedJob, true},
+		{"live changes only", EventFilter{Actions: []string{""}}, deletedJob, false},
+		{"namespace", EventFilter{Namespaces: []string{"production"}}, oomKill, true},
+		{"other namespace", EventFilter{Namespaces: []string{"production"}}, failedDeployment, false},
+		{"job pattern", EventFilter{Jobs: []string{"web-*"}}, oomKill, true},
+		{"other job pattern", EventFilter{Jobs: []string{"web-*"}}, failedDeployment, false},
+		{
+			name:   "nested string",
+			filter: EventFilter{Match: map[string][]string{"TaskEvent.Details.oom_killed": {"true"}}},
+			event:  oomKill,
+			want:   true,
+		},
+		{
+			name:   "number",
+			filter: EventFilter{Match: map[string][]string{"TaskEvent.ExitCode": {"1", "137"}}},
+			event:  oomKill,
+			want:   true,
+		},
+		{
+			name:   "lowercased path",
+			filter: EventFilter{Match: map[string][]string{"taskevent.details.oom_killed": {"true"}}},
+			event:  oomKill,
+			want:   true,
+		},
+		{
+			name:   "missing field",
+			filter: EventFilter{Match: map[string][]string{"TaskEvent.Details.oom_killed": {"true"}}},
+			event:  failedDeployment,
+			want:   false,
+		},
+		{
+			name: "all criteria",
+			filter: EventFilter{
+				Types: []string{EventTypeDeployment},
+				Match: map[string][]string{"Status": {api.DeploymentStatusFailed}},
+			},
+			event: failedDeployment,
+			want:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(tt.event); got != tt.want {
+				t.Errorf("EventFilter.Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventFilter_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  EventFilter
+		wantErr bool
+	}{
+		{"valid", EventFilter{Jobs: []string{"web-*"}, Match: map[string][]string{"Status": {"failed"}}}, false},
+		{"invalid job pattern", EventFilter{Jobs: []string{"web-["}}, true},
+		{"empty match path", EventFilter{Match: map[string][]string{"": {"failed"}}}, true},
+		{"match without values", EventFilter{Match: map[string][]string{"Status": {}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filter.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("EventFilter.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Incident providers
+const (
+	IncidentProviderPagerDuty = "pagerduty"
+	IncidentProviderOpsgenie  = "opsgenie"
+)
+
+// Default incident API URLs
+const (
+	DefaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+	DefaultOpsgenieURL  = "https://api.opsgenie.com"
+)
+
+// Incident severities
+const (
+	IncidentSeverityCritical = "critical"
+	IncidentSeverityError    = "error"
+	IncidentSeverityWarning  = "warning"
+	IncidentSeverityInfo     = "info"
+)
+
+// incidentSource is the source of Opsgenie alerts
+const incidentSource = "nomad-event-logger"
+
+// DefaultIncidentSummary is the summary template of rules without one
+const DefaultIncidentSummary = `Nomad {{.Type}} {{.Field "id"}}` +
+	`{{with .Field "job"}} of job {{.}}{{end}}` +
+	`{{with .Field "namespace"}} in {{.}}{{end}}` +
+	`{{with .Field "cluster"}} on {{.}}{{end}}`
+
+// DefaultIncidentRules page for failed deployments and down nodes, and
+// resolve once the node is ready again or a later deployment of the job
+// succeeds. A failed deployment never changes status again, so its alert is
+// keyed by the job instead of the deployment.
+var DefaultIncidentRules = []IncidentRule{
+	{
+		Name:     "deployment-failed",
+		Severity: IncidentSeverityError,
+		Key:      FieldJob,
+		Trigger: EventFilter{
+			Types: []string{EventTypeDeployment},
+			Match: map[string][]string{"Status": {"failed"}},
+		},
+		Resolve: EventFilter{
+			Types: []string{EventTypeDeployment},
+			Match: map[string][]string{"Status": {"successful"}},
+		},
+	},
+	{
+		Name:     "node-down",
+		Severity: IncidentSeverityCritical,
+		Trigger: EventFilter{
+			Types: []string{EventTypeNode},
+			Match: map[string][]string{"Status": {"down"}},
+		},
+		Resolve: EventFilter{
+			Types: []string{EventTypeNode},
+			Match: map[string][]string{"Status": {"ready"}},
+		},
+	},
+}
+
+// incidentSeverities are the valid severities and their Opsgenie priorities
+var incidentSeverities = map[string]string{
+	IncidentSeverityCritical: "P1",
+	IncidentSeverityError:    "P2",
+	IncidentSeverityWarning:  "P3",
+	IncidentSeverityInfo:     "P5",
+}
+
+// incidentRule is a rule with its parsed summary template
+type incidentRule struct {
+	IncidentRule
+	summary *template.Template
+}
+
+// IncidentSink triggers PagerDuty or Opsgenie alerts for events matching a
+// rule's trigger filter and resolves them for events matching its resolve
+// filter. Both are keyed by the object ID, so an alert is resolved by a
+// later event about the same object. Alerts are sent in the background, so
+// a slow provider does not hold up the event managers.
+type IncidentSink struct {
+	config  IncidentConfig
+	client  *http.Client
+	rules   []*incidentRule
+	batcher *eventBatcher
+
+	// sent holds the rules that handled sentEvent, so sending it again
+	// after a failure skips them
+	sentEvent *Event
+	sent      map[*incidentRule]bool
+}
+
+func NewIncidentSink(config IncidentConfig) (*IncidentSink, error) {
+	switch config.Provider {
+	case IncidentProviderPagerDuty:
+		if config.URL == "" {
+			config.URL = DefaultPagerDutyURL
+		}
+	case IncidentProviderOpsgenie:
+		if config.URL == "" {
+			config.URL = DefaultOpsgenieURL
+		}
+	default:
+		return nil, fmt.Errorf("unknown incident provider: %s", config.Provider)
+	}
+
+	if config.Key == "" {
+		return nil, fmt.Errorf("incident integration key is required")
+	}
+
+	if len(config.Rules) == 0 {
+		config.Rules = DefaultIncidentRules
+	}
+
+	s := &IncidentSink{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}
+
+	for _, rule := range config.Rules {
+		if rule.Severity == "" {
+			rule.Severity = IncidentSeverityError
+		}
+
+		text := rule.Summary
+		if text == "" {
+			text = DefaultIncidentSummary
+		}
+
+		summary, err := template.New(rule.Name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("incident rule %s: failed to parse summary: %w", rule.Name, err)
+		}
+
+		s.rules = append(s.rules, &incidentRule{IncidentRule: rule, summary: summary})
+	}
+
+	s.batcher = newEventBatcher("incident", BatchConfig{Size: 1}, s.deliver)
+
+	return s, nil
+}
+
+// Write queues the event when it matches the trigger or resolve filter of
+// any rule
+func (s *IncidentSink) Write(event *Event) error {
+	for _, rule := range s.rules {
+		if rule.Trigger.Matches(event) || (!rule.Resolve.isEmpty() && rule.Resolve.Matches(event)) {
+			return s.batcher.Add(event)
+		}
+	}
+
+	return nil
+}
+
+func (s *IncidentSink) Accepted() uint64 {
+	return s.batcher.Accepted()
+}
+
+func (s *IncidentSink) Delivered() uint64 {
+	return s.batcher.Delivered()
+}
+
+// deliver triggers or resolves an alert for every rule each event matches.
+// Rules without a resolve filter never resolve their alerts. Resolves are
+// sent whether or not this instance triggered the alert, so alerts opened
+// before a restart or by a previous leader are resolved too; both providers
+// ignore resolves for alerts that are not open. Events that failed with a
+// transient error stay queued in the batcher and are sent again with the
+// next flush, only for the rules that did not handle them.
+func (s *IncidentSink) deliver(events []*Event) error {
+	for _, event := range events {
+		if err := s.deliverEvent(event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *IncidentSink) deliverEvent(event *Event) error {
+	if event != s.sentEvent {
+		s.sentEvent = event
+		s.sent = make(map[*incidentRule]bool)
+	}
+
+	var errs []error
+	for _, rule := range s.rules {
+		if s.sent[rule] {
+			continue
+		}
+
+		var err error
+		switch {
+		case rule.Trigger.Matches(event):
+			err = s.trigger(rule, event)
+		case !rule.Resolve.isEmpty() && rule.Resolve.Matches(event):
+			err = s.resolve(rule, event)
+		default:
+			continue
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("incident rule %s: %w", rule.Name, err))
+			continue
+		}
+		s.sent[rule] = true
+	}
+
+	return errors.Join(errs...)
+}
+
+// incidentDedupKey identifies the alert of a rule for the event's object,
+// or for the value of the rule's key field
+func incidentDedupKey(rule *incidentRule, event *Event) string {
+	field := rule.Key
+	if field == "" {
+		field = FieldID
+	}
+	return strings.Join([]string{"nomad", rule.Name, event.Cluster, event.Namespace, event.Type, event.Field(field)}, "/")
+}
+
+func (s *IncidentSink) trigger(rule *incidentRule, event *Event) error {
+	var summary strings.Builder
+	if err := rule.summary.Execute(&summary, event); err != nil {
+		return fmt.Errorf("failed to render summary: %w", err)
+	}
+
+	key := incidentDedupKey(rule, event)
+	message := rule.Name + ": " + strings.TrimSpace(summary.String())
+
+	if s.config.Provider == IncidentProviderOpsgenie {
+		return s.send(s.config.URL+"/v2/alerts", opsgenieAlert{
+			Message:     truncate(message, 130),
+			Alias:       truncate(key, 512),
+			Description: truncate(message, 15000),
+			Priority:    incidentSeverities[rule.Severity],
+			Source:      incidentSource,
+			Tags:        []string{"nomad", event.Type, rule.Name},
+			Details:     incidentDetails(event),
+		})
+	}
+
+	source := event.Cluster
+	if source == "" {
+		source = "nomad"
+	}
+
+	return s.send(s.config.URL, pagerDutyEvent{
+		RoutingKey:  s.config.Key,
+		EventAction: "trigger",
+		DedupKey:    key,
+		Payload: &pagerDutyPayload{
+			Summary:       truncate(message, 1024),
+			Source:        source,
+			Severity:      rule.Severity,
+			Timestamp:     event.Time.UTC().Format(time.RFC3339),
+			Component:     event.Type,
+			Group:         event.Namespace,
+			Class:         rule.Name,
+			CustomDetails: event,
+		},
+	})
+}
+
+func (s *IncidentSink) resolve(rule *incidentRule, event *Event) error {
+	key := incidentDedupKey(rule, event)
+
+	if s.config.Provider == IncidentProviderOpsgenie {
+		closeURL := s.config.URL + "/v2/alerts/" + url.PathEscape(truncate(key, 512)) + "/close?identifierType=alias"
+		return s.send(closeURL, opsgenieClose{
+			Source: incidentSource,
+			Note:   "Resolved by Nomad " + event.Type + " event",
+		})
+	}
+
+	return s.send(s.config.URL, pagerDutyEvent{
+		RoutingKey:  s.config.Key,
+		EventAction: "resolve",
+		DedupKey:    key,
+	})
+}
+
+// send POSTs the JSON body to the provider, retrying transient failures
+func (s *IncidentSink) send(endpoint string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	return withRetry(s.config.Retry, func() error {
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		if s.config.Provider == IncidentProviderOpsgenie {
+			req.Header.Set("Authorization", "GenieKey "+s.config.Key)
+		}
+
+		resp, err := doHTTPRequest(s.client, req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+
+		return nil
+	})
+}
+
+func (s *IncidentSink) Close() error {
+	return s.batcher.Close()
+}
+
+// pagerDutyEvent is a PagerDuty Events API v2 event
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string `json:"summary"`
+	Source        string `json:"source"`
+	Severity      string `json:"severity"`
+	Timestamp     string `json:"timestamp"`
+	Component     string `json:"component,omitempty"`
+	Group         string `json:"group,omitempty"`
+	Class         string `json:"class,omitempty"`
+	CustomDetails *Event `json:"custom_details"`
+}
+
+// opsgenieAlert is the body of an Opsgenie create alert request
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description"`
+	Priority    string            `json:"priority"`
+	Source      string            `json:"source"`
+	Tags        []string          `json:"tags"`
+	Details     map[string]string `json:"details"`
+}
+
+// opsgenieClose is the body of an Opsgenie close alert request
+type opsgenieClose struct {
+	Source string `json:"source"`
+	Note   string `json:"note"`
+}
+
+// incidentDetails returns the event fields that are set
+func incidentDetails(event *Event) map[string]string {
+	details := make(map[string]string)
+	for _, field := range EventFields {
+		if value := event.Field(field); value != "" {
+			details[field] = value
+		}
+	}
+	return details
+}
@@ -0,0 +1,213 @@
+package agent
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// incidentRequest is a request received by the fake incident API
+type incidentRequest struct {
+	path          string
+	query         string
+	authorization string
+	body          map[string]any
+}
+
+func newFakeIncidentAPI(t *testing.T) (*httptest.Server, *[]incidentRequest) {
+	var requests []incidentRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		req := incidentRequest{
+			path:          r.URL.EscapedPath(),
+			query:         r.URL.RawQuery,
+			authorization: r.Header.Get("Authorization"),
+		}
+		if err := json.Unmarshal(body, &req.body); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		requests = append(requests, req)
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func TestIncidentSink_PagerDuty(t *testing.T) {
+	server, requests := newFakeIncidentAPI(t)
+
+	sink, err := NewIncidentSink(IncidentConfig{
+		Provider: IncidentProviderPagerDuty,
+		URL:      server.URL,
+		Key:      "routing-key",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create incident sink: %v", err)
+	}
+	defer sink.Close()
+
+	events := []*Event{
+		// Resolves are sent even without an alert triggered by this instance
+		NewEvent(EventTypeNode, &api.NodeListStub{ID: "node-2", Status: api.NodeStatusReady}),
+		NewEvent(EventTypeDeployment, &api.Deployment{ID: "d-1", Namespace: "default", JobID: "web", Status: api.DeploymentStatusRunning}),
+		NewEvent(EventTypeDeployment, &api.Deployment{ID: "d-1", Namespace: "default", JobID: "web", Status: api.DeploymentStatusFailed}),
+		// A later deployment of the job resolves the alert
+		NewEvent(EventTypeDeployment, &api.Deployment{ID: "d-2", Namespace: "default", JobID: "web", Status: api.DeploymentStatusSuccessful}),
+		NewEvent(EventTypeNode, &api.NodeListStub{ID: "node-1", Status: api.NodeStatusDown}),
+	}
+	for _, event := range events {
+		if err := sink.Write(event); err != nil {
+			t.Fatalf("IncidentSink.Write() error = %v", err)
+		}
+	}
+	waitForDelivered(t, sink, 4)
+
+	if len(*requests) != 4 {
+		t.Fatalf("Expected 4 requests, got %d", len(*requests))
+	}
+
+	nodeResolve, trigger, resolve, node := (*requests)[0].body, (*requests)[1].body, (*requests)[2].body, (*requests)[3].body
+
+	if nodeResolve["event_action"] != "resolve" || nodeResolve["dedup_key"] != "nomad/node-down///node/node-2" {
+		t.Errorf("Expected the node alert to be resolved, got %v", nodeResolve)
+	}
+
+	if trigger["event_action"] != "trigger" || trigger["routing_key"] != "routing-key" {
+		t.Errorf("Unexpected trigger event %v", trigger)
+	}
+	if want := "nomad/deployment-failed//default/deployment/web"; trigger["dedup_key"] != want {
+		t.Errorf("Expected dedup key %q, got %v", want, trigger["dedup_key"])
+	}
+
+	payload := trigger["payload"].(map[string]any)
+	if want := "deployment-failed: Nomad deployment d-1 of job web in default"; payload["summary"] != want {
+		t.Errorf("Expected summary %q, got %v", want, payload["summary"])
+	}
+	if payload["severity"] != IncidentSeverityError {
+		t.Errorf("Expected severity error, got %v", payload["severity"])
+	}
+
+	if resolve["event_action"] != "resolve" || resolve["dedup_key"] != trigger["dedup_key"] {
+		t.Errorf("Expected the deployment alert to be resolved, got %v", resolve)
+	}
+	if _, ok := resolve["payload"]; ok {
+		t.Error("Expected no payload for a resolve event")
+	}
+
+	if node["event_action"] != "trigger" || node["payload"].(map[string]any)["severity"] != IncidentSeverityCritical {
+		t.Errorf("Expected a critical node alert, got %v", node)
+	}
+}
+
+func TestIncidentSink_Opsgenie(t *testing.T) {
+	server, requests := newFakeIncidentAPI(t)
+
+	sink, err := NewIncidentSink(IncidentConfig{
+		Provider: IncidentProviderOpsgenie,
+		URL:      server.URL,
+		Key:      "api-key",
+		Rules: []IncidentRule{{
+			Name:     "oom-kill",
+			Severity: IncidentSeverityWarning,
+			Summary:  "Task {{.Data.TaskName}} was OOM killed",
+			Trigger: EventFilter{
+				Types: []string{EventTypeTask},
+				Match: map[string][]string{"TaskEvent.Details.oom_killed": {"true"}},
+			},
+			Resolve: EventFilter{
+				Types: []string{EventTypeTask},
+				Match: map[string][]string{"TaskEvent.Type": {api.TaskStarted}},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create incident sink: %v", err)
+	}
+	defer sink.Close()
+
+	task := &TaskEvent{
+		AllocationID: "alloc-1",
+		TaskName:     "nginx",
+		TaskEvent:    &api.TaskEvent{Type: api.TaskTerminated, Details: map[string]string{"oom_killed": "true"}},
+	}
+	restarted := *task
+	restarted.TaskEvent = &api.TaskEvent{Type: api.TaskStarted}
+
+	for _, data := range []*TaskEvent{task, &restarted} {
+		if err := sink.Write(NewEvent(EventTypeTask, data)); err != nil {
+			t.Fatalf("IncidentSink.Write() error = %v", err)
+		}
+	}
+	waitForDelivered(t, sink, 2)
+
+	if len(*requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(*requests))
+	}
+
+	create, closeReq := (*requests)[0], (*requests)[1]
+	if create.path != "/v2/alerts" || create.authorization != "GenieKey api-key" {
+		t.Errorf("Unexpected create request %s with %q", create.path, create.authorization)
+	}
+	if create.body["message"] != "oom-kill: Task nginx was OOM killed" || create.body["priority"] != "P3" {
+		t.Errorf("Unexpected alert %v", create.body)
+	}
+	if create.body["alias"] != "nomad/oom-kill///task/alloc-1" {
+		t.Errorf("Unexpected alias %v", create.body["alias"])
+	}
+
+	if closeReq.path != "/v2/alerts/nomad%2Foom-kill%2F%2F%2Ftask%2Falloc-1/close" || closeReq.query != "identifierType=alias" {
+		t.Errorf("Unexpected close request %s?%s", closeReq.path, closeReq.query)
+	}
+}
+
+func TestIncidentSink_RunsEveryRule(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// The first rule's request fails
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	trigger := EventFilter{Types: []string{EventTypeNode}, Match: map[string][]string{"Status": {"down"}}}
+	sink, err := NewIncidentSink(IncidentConfig{
+		Provider: IncidentProviderPagerDuty,
+		URL:      server.URL,
+		Key:      "routing-key",
+		Rules: []IncidentRule{
+			{Name: "first", Trigger: trigger},
+			{Name: "second", Trigger: trigger},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create incident sink: %v", err)
+	}
+	defer sink.Close()
+
+	event := NewEvent(EventTypeNode, &api.NodeListStub{ID: "node-1", Status: api.NodeStatusDown})
+	if err := sink.deliver([]*Event{event}); err == nil {
+		t.Error("Expected an error for the failed alert")
+	}
+	if requests != 2 {
+		t.Errorf("Expected every rule to send its alert, got %d requests", requests)
+	}
+
+	// Sending the event again only retries the failed rule
+	if err := sink.deliver([]*Event{event}); err != nil {
+		t.Errorf("IncidentSink.deliver() error = %v", err)
+	}
+	if requests != 3 {
+		t.Errorf("Expected only the failed alert to be sent again, got %d requests", requests)
+	}
+}
@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	nomadapi "github.com/hashicorp/nomad/api"
@@ -11,19 +12,30 @@ import (
 // JobManager manages job events
 type JobManager struct {
 	*BaseManager
+	tracker *objectTracker[*nomadapi.JobListStub]
 }
 
-func NewJobManager(nomadAddr, nomadToken string, sinks []Sink) (*JobManager, error) {
-	baseManager, err := NewBaseManager(nomadAddr, nomadToken, sinks, EventTypeJob, 0) // No rate limit for jobs
+func NewJobManager(config ManagerConfig) (*JobManager, error) {
+	baseManager, err := NewBaseManager(config, EventTypeJob, 0) // No rate limit for jobs
 	if err != nil {
 		return nil, err
 	}
 	return &JobManager{
 		BaseManager: baseManager,
+		tracker:     newObjectTracker[*nomadapi.JobListStub](),
 	}, nil
 }
 
 func (m *JobManager) Start(ctx context.Context) error {
+	checkpoint := m.restoreCheckpoint()
+	if checkpoint != nil {
+		m.tracker.Restore(checkpoint.Objects, func(id string) *nomadapi.JobListStub {
+			namespace, jobID, _ := strings.Cut(id, "/")
+			return &nomadapi.JobListStub{ID: jobID, Name: jobID, Namespace: namespace}
+		})
+	}
+	m.prepareFirstRun(checkpoint)
+
 	m.wg.Add(1)
 	go func() {
 		defer m.wg.Done()
@@ -46,7 +58,7 @@ func (m *JobManager) watchJobs(ctx context.Context) error {
 	}
 
 	// Get jobs with blocking query
-	jobs, _, err := m.nomadClient.Jobs().List(opts)
+	jobs, meta, err := m.nomadClient.Jobs().List(opts.WithContext(ctx))
 	if err != nil {
 		return fmt.Errorf("failed to get jobs: %w", err)
 	}
@@ -55,7 +67,21 @@ func (m *JobManager) watchJobs(ctx context.Context) error {
 	maxModifyIndex := m.lastIndex
 
 	// Process jobs
+	current := make(map[string]*nomadapi.JobListStub, len(jobs))
 	for _, job := range jobs {
+		// Skip jobs outside of the watched namespaces
+		if !m.watchesNamespace(job.Namespace) {
+			continue
+		}
+
+		id := namespacedID(job.Namespace, job.ID)
+		current[id] = job
+
+		// Emit the current state on the first run when requested
+		if m.snapshotPending() {
+			m.writeSnapshotEvent(EventTypeJob, job)
+		}
+
 		// Only process jobs whose ModifyIndex is greater than our lastIndex
 		if job.ModifyIndex <= m.lastIndex {
 			continue
@@ -71,7 +97,13 @@ func (m *JobManager) watchJobs(ctx context.Context) error {
 			continue
 		}
 
-		nomadEvent := NewEvent(EventTypeJob, job)
+		// Attach the field changes since the previously seen version
+		previous, known := m.tracker.Get(id)
+		nomadEvent := m.newChangeEvent(previous, job, known)
+		if nomadEvent == nil {
+			continue
+		}
+
 		if err := m.WriteEvent(nomadEvent); err != nil {
 			m.logger.Error("Failed to write job event",
 				"error", err.Error(),
@@ -79,6 +111,11 @@ func (m *JobManager) watchJobs(ctx context.Context) error {
 		}
 	}
 
+	// Jobs missing from the response have been purged
+	if meta != nil {
+		writeDeletedEvents(m.BaseManager, m.tracker.Sync(current), meta.LastIndex)
+	}
+
 	// Update the manager's lastIndex to the maximum ModifyIndex found
 	if maxModifyIndex > m.lastIndex {
 		m.lastIndex = maxModifyIndex
@@ -87,5 +124,7 @@ func (m *JobManager) watchJobs(ctx context.Context) error {
 	// Mark first run as complete after processing
 	m.markFirstRunComplete()
 
+	m.saveCheckpoint(Checkpoint{Index: m.lastIndex, Objects: m.checkpointObjects(m.tracker.IDs)})
+
 	return nil
 }
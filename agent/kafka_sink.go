@@ -0,0 +1,238 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// DefaultKafkaPartitionKey keys records by job so that all events of a job
+// land on the same partition, in order
+const DefaultKafkaPartitionKey = "{job}"
+
+// KafkaSink produces events to a Kafka topic. Records are produced
+// asynchronously; the sink tracks the records still in flight so managers
+// only checkpoint produced events, and reports failed produces on the next
+// write. A record that failed holds the checkpoint back before it, so it is
+// produced again after a restart.
+type KafkaSink struct {
+	client       *kgo.Client
+	topic        string
+	partitionKey string
+
+	accepted    uint64
+	inflight    map[uint64]struct{}
+	failed      []error
+	firstFailed uint64
+	mu          sync.Mutex
+}
+
+func NewKafkaSink(config KafkaConfig) (*KafkaSink, error) {
+	opts, err := kafkaClientOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka client: %w", err)
+	}
+
+	return &KafkaSink{
+		client:       client,
+		topic:        config.Topic,
+		partitionKey: config.PartitionKey,
+		inflight:     make(map[uint64]struct{}),
+	}, nil
+}
+
+// kafkaClientOptions translates the sink configuration into client options
+func kafkaClientOptions(config KafkaConfig) ([]kgo.Opt, error) {
+	if len(config.Brokers) == 0 {
+		return nil, fmt.Errorf("kafka brokers are required")
+	}
+	if config.Topic == "" {
+		return nil, fmt.Errorf("kafka topic is required")
+	}
+
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(config.Brokers...),
+		kgo.DefaultProduceTopic(config.Topic),
+		// Records with the same key always go to the same partition
+		kgo.RecordPartitioner(kgo.StickyKeyPartitioner(nil)),
+	}
+
+	if config.ClientID != "" {
+		opts = append(opts, kgo.ClientID(config.ClientID))
+	}
+
+	switch config.Acks {
+	case "", "all":
+		opts = append(opts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	case "leader":
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()))
+	case "none":
+		opts = append(opts, kgo.RequiredAcks(kgo.NoAck()))
+	default:
+		return nil, fmt.Errorf("unknown kafka acks setting: %s", config.Acks)
+	}
+
+	if config.Idempotent {
+		// The idempotent producer requires acks from all in-sync replicas
+		if config.Acks != "" && config.Acks != "all" {
+			return nil, fmt.Errorf("kafka idempotent producer requires acks all")
+		}
+	} else {
+		// A single request in flight per broker keeps retried batches in order
+		opts = append(opts, kgo.DisableIdempotentWrite(), kgo.MaxProduceRequestsInflightPerBroker(1))
+	}
+
+	switch config.Compression {
+	case "", "none":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.NoCompression()))
+	case "gzip":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.GzipCompression()))
+	case "snappy":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.SnappyCompression()))
+	case "lz4":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.Lz4Compression()))
+	case "zstd":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.ZstdCompression()))
+	default:
+		return nil, fmt.Errorf("unknown kafka compression: %s", config.Compression)
+	}
+
+	tlsConfig, err := newClientTLSConfig(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts = append(opts, kgo.DialTLSConfig(tlsConfig))
+	}
+
+	if config.SASL.Mechanism != "" {
+		mechanism, err := kafkaSASLMechanism(config.SASL)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+
+	return opts, nil
+}
+
+// kafkaSASLMechanism returns the SASL mechanism used to authenticate
+func kafkaSASLMechanism(config KafkaSASLConfig) (sasl.Mechanism, error) {
+	switch strings.ToLower(config.Mechanism) {
+	case "plain":
+		return plain.Auth{User: config.Username, Pass: config.Password}.AsMechanism(), nil
+	case "scram-sha-256":
+		return scram.Auth{User: config.Username, Pass: config.Password}.AsSha256Mechanism(), nil
+	case "scram-sha-512":
+		return scram.Auth{User: config.Username, Pass: config.Password}.AsSha512Mechanism(), nil
+	default:
+		return nil, fmt.Errorf("unknown kafka SASL mechanism: %s", config.Mechanism)
+	}
+}
+
+// Write produces the event asynchronously. Records are retried by the
+// client until they are delivered; records that failed since the previous
+// write are reported as an error.
+func (s *KafkaSink) Write(event *Event) error {
+	data, err := event.ToJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	record := &kgo.Record{
+		Topic: s.topic,
+		Value: data,
+		Headers: []kgo.RecordHeader{
+			{Key: "type", Value: []byte(event.Type)},
+		},
+	}
+	if key := ExpandEventTemplate(s.partitionKey, event); key != "" {
+		record.Key = []byte(key)
+	}
+
+	s.mu.Lock()
+	s.accepted++
+	seq := s.accepted
+	s.inflight[seq] = struct{}{}
+	failed := s.failed
+	s.failed = nil
+	s.mu.Unlock()
+
+	s.client.Produce(context.Background(), record, func(record *kgo.Record, err error) {
+		s.mu.Lock()
+		delete(s.inflight, seq)
+		if err != nil {
+			s.failed = append(s.failed, err)
+			if s.firstFailed == 0 || seq < s.firstFailed {
+				s.firstFailed = seq
+			}
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			GetLogger().Error("Failed to produce event to Kafka",
+				"topic", record.Topic,
+				"key", string(record.Key),
+				"error", err.Error(),
+			)
+		}
+	})
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to produce %d events to Kafka: %w", len(failed), failed[0])
+	}
+	return nil
+}
+
+// Accepted returns the number of events handed to the client
+func (s *KafkaSink) Accepted() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.accepted
+}
+
+// Delivered returns the number of events, in write order, that were
+// produced. Records complete out of order across partitions, so this is the
+// count before the oldest record still in flight or that failed.
+func (s *KafkaSink) Delivered() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivered := s.accepted
+	for seq := range s.inflight {
+		delivered = min(delivered, seq-1)
+	}
+	if s.firstFailed > 0 {
+		delivered = min(delivered, s.firstFailed-1)
+	}
+	return delivered
+}
+
+// Close waits for buffered records to be delivered
+func (s *KafkaSink) Close() error {
+	err := s.client.Flush(context.Background())
+	s.client.Close()
+	if err != nil {
+		return fmt.Errorf("failed to flush Kafka records: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.failed) > 0 {
+		return fmt.Errorf("failed to produce %d events to Kafka: %w", len(s.failed), s.failed[0])
+	}
+	return nil
+}
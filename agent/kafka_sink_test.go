@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestKafkaSink(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(4, "nomad-events"))
+	if err != nil {
+		t.Fatalf("Failed to create fake Kafka cluster: %v", err)
+	}
+	defer cluster.Close()
+
+	sink, err := NewKafkaSink(KafkaConfig{
+		Brokers:      cluster.ListenAddrs(),
+		Topic:        "nomad-events",
+		PartitionKey: DefaultKafkaPartitionKey,
+		Idempotent:   true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Kafka sink: %v", err)
+	}
+
+	jobs := []string{"web", "api", "web", "api", "web"}
+	for _, job := range jobs {
+		if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: job, Namespace: "default"})); err != nil {
+			t.Fatalf("KafkaSink.Write() error = %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("KafkaSink.Close() error = %v", err)
+	}
+
+	consumer, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.ConsumeTopics("nomad-events"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create consumer: %v", err)
+	}
+	defer consumer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	partitions := make(map[string]int32)
+	counts := make(map[string]int)
+	for received := 0; received < len(jobs); {
+		fetches := consumer.PollFetches(ctx)
+		if ctx.Err() != nil {
+			t.Fatalf("Received %d of %d records", received, len(jobs))
+		}
+
+		fetches.EachRecord(func(record *kgo.Record) {
+			received++
+			key := string(record.Key)
+			counts[key]++
+
+			// Every event of a job lands on the same partition
+			if partition, ok := partitions[key]; ok && partition != record.Partition {
+				t.Errorf("Expected key %s on partition %d, got %d", key, partition, record.Partition)
+			}
+			partitions[key] = record.Partition
+		})
+	}
+
+	if counts["web"] != 3 || counts["api"] != 2 {
+		t.Errorf("Expected 3 web and 2 api records, got %v", counts)
+	}
+}
+
+func TestKafkaSink_ReportsFailedProduces(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, "nomad-events"))
+	if err != nil {
+		t.Fatalf("Failed to create fake Kafka cluster: %v", err)
+	}
+	defer cluster.Close()
+
+	sink, err := NewKafkaSink(KafkaConfig{
+		Brokers: cluster.ListenAddrs(),
+		Topic:   "nomad-events",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create Kafka sink: %v", err)
+	}
+
+	// Records larger than the maximum batch size are never produced
+	large := NewEvent(EventTypeJob, map[string]string{"id": strings.Repeat("x", 2<<20)})
+	if err := sink.Write(large); err != nil {
+		t.Fatalf("KafkaSink.Write() error = %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sink.mu.Lock()
+		inflight := len(sink.inflight)
+		sink.mu.Unlock()
+
+		if inflight == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the produce to complete")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The failure is reported by the next write
+	if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: "web"})); err == nil {
+		t.Error("Expected an error for the failed produce")
+	}
+	if err := sink.Close(); err != nil {
+		t.Errorf("KafkaSink.Close() error = %v", err)
+	}
+
+	// The failed record holds back the records produced after it
+	if sink.Delivered() != 0 {
+		t.Errorf("Expected no delivered events after the failed produce, got %d", sink.Delivered())
+	}
+}
+
+func TestKafkaClientOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  KafkaConfig
+		wantErr bool
+	}{
+		{
+			name:   "defaults",
+			config: KafkaConfig{Brokers: []string{"localhost:9092"}, Topic: "events"},
+		},
+		{
+			name: "sasl and compression",
+			config: KafkaConfig{
+				Brokers:     []string{"localhost:9092"},
+				Topic:       "events",
+				Compression: "zstd",
+				SASL:        KafkaSASLConfig{Mechanism: "scram-sha-512", Username: "user", Password: "pass"},
+			},
+		},
+		{
+			name:    "idempotent without acks all",
+			config:  KafkaConfig{Brokers: []string{"localhost:9092"}, Topic: "events", Acks: "leader", Idempotent: true},
+			wantErr: true,
+		},
+		{
+			name:    "unknown compression",
+			config:  KafkaConfig{Brokers: []string{"localhost:9092"}, Topic: "events", Compression: "brotli"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown SASL mechanism",
+			config:  KafkaConfig{Brokers: []string{"localhost:9092"}, Topic: "events", SASL: KafkaSASLConfig{Mechanism: "gssapi"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := kafkaClientOptions(tt.config)
+			if tt.wantErr && err == nil {
+				t.Error("kafkaClientOptions() expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("kafkaClientOptions() error = %v", err)
+			}
+		})
+	}
+}
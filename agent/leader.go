@@ -0,0 +1,212 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+)
+
+// LeaderElector campaigns for leadership by holding a lock on a Nomad
+// Variable. Only one instance sharing the lock path leads at a time.
+type LeaderElector struct {
+	nomadClient *nomadapi.Client
+	path        string
+	ttl         time.Duration
+	lockDelay   time.Duration
+	lock        *nomadapi.Variable
+	acquiredAt  time.Time
+	logger      *slog.Logger
+}
+
+func NewLeaderElector(cluster ClusterConfig, config HAConfig) (*LeaderElector, error) {
+	client, err := newNomadClient(cluster, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &LeaderElector{
+		nomadClient: client,
+		path:        config.LockPath,
+		ttl:         config.TTL,
+		lockDelay:   config.LockDelay,
+		logger:      GetLogger(),
+	}, nil
+}
+
+// Run campaigns for leadership until the context is cancelled. While the
+// lock is held, lead is called with a context that is cancelled as soon as
+// leadership is lost.
+func (e *LeaderElector) Run(ctx context.Context, lead func(ctx context.Context) error) {
+	// Standby instances retry well within the TTL so a lock released by a
+	// failed leader is picked up as soon as it expires
+	retryInterval := e.ttl / 3
+
+	for ctx.Err() == nil {
+		if err := e.acquire(); err != nil {
+			if !errors.Is(err, nomadapi.ErrLockConflict) {
+				e.logger.Error("Failed to acquire leadership lock",
+					"lock_path", e.path,
+					"error", err.Error(),
+				)
+			}
+			waitWithContext(ctx, retryInterval)
+			continue
+		}
+
+		e.logger.Info("Acquired leadership",
+			"lock_path", e.path,
+		)
+
+		leaderCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() {
+			done <- lead(leaderCtx)
+		}()
+
+		select {
+		case err := <-e.maintain(leaderCtx):
+			e.logger.Error("Lost leadership",
+				"lock_path", e.path,
+				"error", err.Error(),
+			)
+			cancel()
+			<-done
+			e.lock = nil
+		case err := <-done:
+			if err != nil {
+				e.logger.Error("Leader failed, releasing leadership",
+					"lock_path", e.path,
+					"error", err.Error(),
+				)
+			}
+			cancel()
+			e.release()
+			waitWithContext(ctx, retryInterval)
+		case <-ctx.Done():
+			cancel()
+			<-done
+			e.release()
+		}
+	}
+}
+
+// acquire tries to take the lock once
+func (e *LeaderElector) acquire() error {
+	variable := nomadapi.NewVariable(e.path)
+	variable.Lock = &nomadapi.VariableLock{
+		TTL:       e.ttl.String(),
+		LockDelay: e.lockDelay.String(),
+	}
+
+	// The TTL starts when Nomad handles the request, so it is measured from
+	// before the request was sent
+	sent := time.Now()
+	lock, _, err := e.nomadClient.Variables().AcquireLock(variable, nil)
+	if err != nil {
+		if isLockConflict(err) {
+			return fmt.Errorf("lock is held by another instance: %w", nomadapi.ErrLockConflict)
+		}
+		return err
+	}
+
+	e.lock = lock
+	e.acquiredAt = sent
+	return nil
+}
+
+// maintain renews the lock until the context is cancelled, sending an error
+// on the returned channel once the lock is lost or could not be renewed
+// within half of its TTL. Stepping down at half the TTL leaves a safety
+// margin, so the leader stops before the lock expires and a standby can
+// acquire it.
+func (e *LeaderElector) maintain(ctx context.Context) <-chan error {
+	errCh := make(chan error, 1)
+	renewed := e.acquiredAt
+
+	// Renewals may still be running while the lock is released, so they
+	// use their own copy of it
+	lock := *e.lock
+
+	go func() {
+		ticker := time.NewTicker(e.ttl / 4)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			// A renewal that hangs is abandoned at the step-down deadline
+			deadline := renewed.Add(e.ttl / 2)
+			renewCtx, cancel := context.WithDeadline(ctx, deadline)
+			sent := time.Now()
+			_, _, err := e.nomadClient.Variables().RenewLock(&lock, (&nomadapi.WriteOptions{}).WithContext(renewCtx))
+			cancel()
+
+			if err == nil {
+				renewed = sent
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			if isLockConflict(err) || !time.Now().Before(deadline) {
+				errCh <- fmt.Errorf("failed to renew leadership lock: %w", err)
+				return
+			}
+
+			e.logger.Error("Failed to renew leadership lock, retrying",
+				"lock_path", e.path,
+				"error", err.Error(),
+			)
+		}
+	}()
+
+	return errCh
+}
+
+// release gives up the lock so a standby can take over immediately
+func (e *LeaderElector) release() {
+	if e.lock == nil {
+		return
+	}
+
+	if _, _, err := e.nomadClient.Variables().ReleaseLock(e.lock, nil); err != nil {
+		e.logger.Error("Failed to release leadership lock",
+			"lock_path", e.path,
+			"error", err.Error(),
+		)
+	} else {
+		e.logger.Info("Released leadership",
+			"lock_path", e.path,
+		)
+	}
+
+	e.lock = nil
+}
+
+// isLockConflict returns whether a lock operation failed because the lock is
+// held by someone else
+func isLockConflict(err error) bool {
+	var responseErr nomadapi.UnexpectedResponseError
+	return errors.As(err, &responseErr) && responseErr.StatusCode() == http.StatusConflict
+}
+
+// waitWithContext waits for the duration or until the context is cancelled
+func waitWithContext(ctx context.Context, duration time.Duration) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
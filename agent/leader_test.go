@@ -0,0 +1,226 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+)
+
+// fakeLock fakes the Nomad Variables lock API for a single lock path
+type fakeLock struct {
+	mu          sync.Mutex
+	holder      string
+	renewStatus int
+	lastRenewed time.Time
+	acquires    int
+	renewals    int
+	releases    int
+}
+
+func (l *fakeLock) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/var/nomad-event-logger/leader" || r.Method != http.MethodPut {
+			http.NotFound(w, r)
+			return
+		}
+
+		var variable nomadapi.Variable
+		if err := json.NewDecoder(r.Body).Decode(&variable); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		query := r.URL.Query()
+		switch {
+		case query.Has("lock-acquire"):
+			l.acquires++
+			if l.holder != "" {
+				http.Error(w, "lock already held", http.StatusConflict)
+				return
+			}
+			l.holder = "leader"
+			l.lastRenewed = time.Now()
+			variable.Lock.ID = l.holder
+			json.NewEncoder(w).Encode(variable)
+		case query.Has("lock-renew"):
+			l.renewals++
+			if l.renewStatus != 0 {
+				http.Error(w, "renewal failed", l.renewStatus)
+				return
+			}
+			if variable.Lock == nil || variable.Lock.ID != l.holder {
+				http.Error(w, "lock not held", http.StatusConflict)
+				return
+			}
+			l.lastRenewed = time.Now()
+			json.NewEncoder(w).Encode(variable.Metadata())
+		case query.Has("lock-release"):
+			l.releases++
+			if variable.Lock == nil || variable.Lock.ID != l.holder {
+				http.Error(w, "lock not held", http.StatusConflict)
+				return
+			}
+			l.holder = ""
+			json.NewEncoder(w).Encode(variable)
+		default:
+			t.Errorf("Unexpected lock operation: %s", r.URL.RawQuery)
+		}
+	}
+}
+
+// do runs fn while holding the fake's mutex
+func (l *fakeLock) do(fn func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fn()
+}
+
+// runElector starts an elector against the fake lock, returning channels
+// signalling when leadership starts and ends and when Run returned
+func runElector(t *testing.T, ctx context.Context, lock *fakeLock, ttl time.Duration) (led, lost, stopped chan struct{}) {
+	t.Helper()
+
+	server := httptest.NewServer(lock.handler(t))
+	t.Cleanup(server.Close)
+
+	elector, err := NewLeaderElector(ClusterConfig{Address: server.URL}, HAConfig{
+		LockPath: "nomad-event-logger/leader",
+		TTL:      ttl,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create leader elector: %v", err)
+	}
+
+	led, lost, stopped = make(chan struct{}, 10), make(chan struct{}, 10), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		elector.Run(ctx, func(ctx context.Context) error {
+			led <- struct{}{}
+			<-ctx.Done()
+			lost <- struct{}{}
+			return nil
+		})
+	}()
+
+	return led, lost, stopped
+}
+
+// waitFor fails the test when nothing is received on the channel in time
+func waitFor(t *testing.T, ch <-chan struct{}, timeout time.Duration, what string) {
+	t.Helper()
+
+	select {
+	case <-ch:
+	case <-time.After(timeout):
+		t.Fatalf("Timed out waiting for %s", what)
+	}
+}
+
+func TestLeaderElector_AcquireRenewRelease(t *testing.T) {
+	lock := &fakeLock{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	led, lost, stopped := runElector(t, ctx, lock, 200*time.Millisecond)
+	waitFor(t, led, time.Second, "leadership")
+
+	// The lock is renewed every quarter of the TTL
+	time.Sleep(300 * time.Millisecond)
+	lock.do(func() {
+		if lock.renewals < 2 {
+			t.Errorf("Expected the lock to be renewed, got %d renewals", lock.renewals)
+		}
+	})
+
+	cancel()
+	waitFor(t, lost, time.Second, "the leader to stop")
+	waitFor(t, stopped, time.Second, "Run to return")
+
+	lock.do(func() {
+		if lock.releases != 1 || lock.holder != "" {
+			t.Errorf("Expected the lock to be released on shutdown, got %d releases, holder %q", lock.releases, lock.holder)
+		}
+	})
+}
+
+func TestLeaderElector_Standby(t *testing.T) {
+	lock := &fakeLock{holder: "other"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	led, _, stopped := runElector(t, ctx, lock, 150*time.Millisecond)
+
+	select {
+	case <-led:
+		t.Fatal("Expected to stand by while another instance holds the lock")
+	case <-time.After(250 * time.Millisecond):
+	}
+
+	// The lock is picked up once the other instance lost it
+	lock.do(func() {
+		if lock.acquires < 2 {
+			t.Errorf("Expected repeated acquire attempts, got %d", lock.acquires)
+		}
+		lock.holder = ""
+	})
+	waitFor(t, led, time.Second, "leadership")
+
+	cancel()
+	waitFor(t, stopped, time.Second, "Run to return")
+}
+
+func TestLeaderElector_StepsDownOnConflict(t *testing.T) {
+	lock := &fakeLock{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	led, lost, stopped := runElector(t, ctx, lock, 200*time.Millisecond)
+	waitFor(t, led, time.Second, "leadership")
+
+	// Another instance took over the lock
+	lock.do(func() { lock.holder = "other" })
+	waitFor(t, lost, time.Second, "the leader to step down")
+
+	cancel()
+	waitFor(t, stopped, time.Second, "Run to return")
+
+	lock.do(func() {
+		if lock.releases != 0 || lock.holder != "other" {
+			t.Errorf("Expected the other instance to keep the lock, got %d releases, holder %q", lock.releases, lock.holder)
+		}
+	})
+}
+
+func TestLeaderElector_StepsDownBeforeExpiry(t *testing.T) {
+	lock := &fakeLock{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ttl := 400 * time.Millisecond
+	led, lost, stopped := runElector(t, ctx, lock, ttl)
+	waitFor(t, led, time.Second, "leadership")
+
+	// Renewals fail, so the lock expires a TTL after the last renewal
+	var lastRenewed time.Time
+	lock.do(func() {
+		lock.renewStatus = http.StatusInternalServerError
+		lastRenewed = lock.lastRenewed
+	})
+	waitFor(t, lost, 2*ttl, "the leader to step down")
+
+	if elapsed := time.Since(lastRenewed); elapsed >= ttl {
+		t.Errorf("Expected the leader to step down before the lock expired, stepped down after %v", elapsed)
+	}
+
+	cancel()
+	waitFor(t, stopped, time.Second, "Run to return")
+}
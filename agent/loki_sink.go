@@ -0,0 +1,194 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxLokiLabels caps the number of labels per stream, as every distinct
+// combination of label values creates a new stream in Loki
+const MaxLokiLabels = 8
+
+// DefaultLokiLabels are the event fields used as stream labels by default
+var DefaultLokiLabels = []string{FieldType, FieldNamespace, FieldJob, FieldTaskGroup, FieldNode}
+
+// LokiSink pushes batches of events as log streams to Grafana Loki
+type LokiSink struct {
+	config  LokiConfig
+	client  *http.Client
+	pushURL string
+	batcher *eventBatcher
+}
+
+// lokiPushRequest is the JSON body of the push API
+type lokiPushRequest struct {
+	Streams []*lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func NewLokiSink(config LokiConfig) (*LokiSink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("loki url is required")
+	}
+
+	if len(config.Labels) == 0 {
+		config.Labels = DefaultLokiLabels
+	}
+	if err := validateLokiLabels(config); err != nil {
+		return nil, err
+	}
+
+	s := &LokiSink{
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout},
+		pushURL: strings.TrimSuffix(config.URL, "/") + "/loki/api/v1/push",
+	}
+	s.batcher = newEventBatcher("loki", config.Batch, s.send)
+
+	return s, nil
+}
+
+// validateLokiLabels checks that the labels are event fields and that the
+// label count stays within MaxLokiLabels
+func validateLokiLabels(config LokiConfig) error {
+	for _, label := range config.Labels {
+		if !isEventField(label) {
+			return fmt.Errorf("unknown loki label field: %s", label)
+		}
+	}
+
+	if count := len(config.Labels) + len(config.StaticLabels); count > MaxLokiLabels {
+		return fmt.Errorf("loki streams are limited to %d labels, got %d", MaxLokiLabels, count)
+	}
+
+	return nil
+}
+
+func (s *LokiSink) Write(event *Event) error {
+	return s.batcher.Add(event)
+}
+
+func (s *LokiSink) Accepted() uint64 {
+	return s.batcher.Accepted()
+}
+
+func (s *LokiSink) Delivered() uint64 {
+	return s.batcher.Delivered()
+}
+
+func (s *LokiSink) Close() error {
+	return s.batcher.Close()
+}
+
+// send groups a batch of events into streams by label set and pushes them
+func (s *LokiSink) send(events []*Event) error {
+	// Entries of a stream are expected in timestamp order
+	events = slices.Clone(events)
+	slices.SortStableFunc(events, func(a, b *Event) int {
+		return a.Time.Compare(b.Time)
+	})
+
+	push := lokiPushRequest{}
+	streams := make(map[string]*lokiStream)
+
+	for _, event := range events {
+		line, err := event.ToJSON()
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+
+		labels := s.labels(event)
+		key := lokiStreamKey(labels)
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			push.Streams = append(push.Streams, stream)
+		}
+
+		stream.Values = append(stream.Values, [2]string{
+			strconv.FormatInt(event.Time.UnixNano(), 10),
+			string(line),
+		})
+	}
+
+	body, err := json.Marshal(push)
+	if err != nil {
+		return fmt.Errorf("failed to marshal push request: %w", err)
+	}
+
+	err = withRetry(s.config.Retry, func() error {
+		req, err := http.NewRequest(http.MethodPost, s.pushURL, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		if s.config.TenantID != "" {
+			req.Header.Set("X-Scope-OrgID", s.config.TenantID)
+		}
+		if s.config.Username != "" {
+			req.SetBasicAuth(s.config.Username, s.config.Password)
+		}
+
+		resp, err := doHTTPRequest(s.client, req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to push %d events to loki: %w", len(events), err)
+	}
+
+	return nil
+}
+
+// labels returns the stream labels of the event. Fields the event does not
+// carry are left out. Loki rejects streams without labels, so events
+// carrying none of the fields are labelled with their type.
+func (s *LokiSink) labels(event *Event) map[string]string {
+	labels := make(map[string]string, len(s.config.Labels)+len(s.config.StaticLabels))
+	for name, value := range s.config.StaticLabels {
+		labels[name] = value
+	}
+	for _, field := range s.config.Labels {
+		if value := event.Field(field); value != "" {
+			labels[field] = value
+		}
+	}
+
+	if len(labels) == 0 {
+		labels[FieldType] = event.Type
+	}
+	return labels
+}
+
+// lokiStreamKey returns a key identifying the label set
+func lokiStreamKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s=%q,", name, labels[name])
+	}
+	return b.String()
+}
@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestLokiSink(t *testing.T) {
+	var push lokiPushRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/push" {
+			t.Errorf("Expected request to /loki/api/v1/push, got %s", r.URL.Path)
+		}
+		if got := r.Header.Get("X-Scope-OrgID"); got != "ops" {
+			t.Errorf("Expected tenant header, got %q", got)
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+			t.Errorf("Failed to decode push request: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink, err := NewLokiSink(LokiConfig{
+		URL:          server.URL,
+		TenantID:     "ops",
+		StaticLabels: map[string]string{"source": "nomad"},
+		Batch:        BatchConfig{Size: 3},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create loki sink: %v", err)
+	}
+	defer sink.Close()
+
+	start := time.Unix(1700000000, 0)
+	events := []*Event{
+		NewEvent(EventTypeTask, &TaskEvent{Namespace: "default", JobID: "web", TaskGroup: "frontend", NodeID: "node-1"}),
+		NewEvent(EventTypeNode, &api.NodeListStub{ID: "node-1"}),
+		NewEvent(EventTypeTask, &TaskEvent{Namespace: "default", JobID: "web", TaskGroup: "frontend", NodeID: "node-1"}),
+	}
+	events[0].Time = start.Add(time.Second)
+	events[1].Time = start
+	events[2].Time = start
+
+	for _, event := range events {
+		if err := sink.Write(event); err != nil {
+			t.Fatalf("LokiSink.Write() error = %v", err)
+		}
+	}
+	waitForDelivered(t, sink, 3)
+
+	if len(push.Streams) != 2 {
+		t.Fatalf("Expected 2 streams, got %d", len(push.Streams))
+	}
+
+	var task *lokiStream
+	for _, stream := range push.Streams {
+		if stream.Stream[FieldType] == EventTypeTask {
+			task = stream
+		}
+	}
+	if task == nil {
+		t.Fatalf("Expected a task stream, got %+v", push.Streams)
+	}
+
+	wantLabels := map[string]string{
+		"source":       "nomad",
+		FieldType:      EventTypeTask,
+		FieldNamespace: "default",
+		FieldJob:       "web",
+		FieldTaskGroup: "frontend",
+		FieldNode:      "node-1",
+	}
+	if len(task.Stream) != len(wantLabels) {
+		t.Errorf("Expected labels %v, got %v", wantLabels, task.Stream)
+	}
+	for name, value := range wantLabels {
+		if task.Stream[name] != value {
+			t.Errorf("Expected label %s=%q, got %q", name, value, task.Stream[name])
+		}
+	}
+
+	// Entries are ordered by time and the line is the event JSON
+	if len(task.Values) != 2 || task.Values[0][0] != "1700000000000000000" || task.Values[1][0] != "1700000001000000000" {
+		t.Errorf("Unexpected task stream values: %v", task.Values)
+	}
+	if !strings.Contains(task.Values[0][1], `"type":"task"`) {
+		t.Errorf("Expected the event JSON as the log line, got %s", task.Values[0][1])
+	}
+}
+
+func TestLokiSink_Labels(t *testing.T) {
+	sink, err := NewLokiSink(LokiConfig{URL: "http://localhost:3100", Labels: []string{FieldJob}})
+	if err != nil {
+		t.Fatalf("Failed to create loki sink: %v", err)
+	}
+	defer sink.Close()
+
+	job := NewEvent(EventTypeJob, &api.JobListStub{ID: "web"})
+	if labels := sink.labels(job); !reflect.DeepEqual(labels, map[string]string{FieldJob: "web"}) {
+		t.Errorf("Expected the job label, got %v", labels)
+	}
+
+	// Events without any of the label fields still get a stream label
+	node := NewEvent(EventTypeNode, &api.NodeListStub{ID: "node-1"})
+	if labels := sink.labels(node); !reflect.DeepEqual(labels, map[string]string{FieldType: EventTypeNode}) {
+		t.Errorf("Expected the type label, got %v", labels)
+	}
+}
+
+func TestValidateLokiLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  LokiConfig
+		wantErr bool
+	}{
+		{
+			name:   "default labels",
+			config: LokiConfig{Labels: DefaultLokiLabels},
+		},
+		{
+			name:    "unknown field",
+			config:  LokiConfig{Labels: []string{"image"}},
+			wantErr: true,
+		},
+		{
+			name: "too many labels",
+			config: LokiConfig{
+				Labels:       DefaultLokiLabels,
+				StaticLabels: map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateLokiLabels(tt.config)
+			if tt.wantErr && err == nil {
+				t.Error("validateLokiLabels() expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("validateLokiLabels() error = %v", err)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 
@@ -15,6 +16,20 @@ type EventManager interface {
 	Start(ctx context.Context) error
 	Stop() error
 	GetEventType() string
+	// FlushCheckpoint saves the checkpoint held back for queued events once
+	// the manager stopped and the sinks delivered them
+	FlushCheckpoint()
+}
+
+// ManagerConfig holds the settings shared by all event managers
+type ManagerConfig struct {
+	Cluster      ClusterConfig
+	Sinks        []Sink
+	RateLimit    time.Duration
+	ChangeFields map[string][]string
+	Namespaces   []string
+	Checkpoints  CheckpointStore
+	InitialState string
 }
 
 // BaseManager provides common functionality for all event managers
@@ -30,33 +45,115 @@ type BaseManager struct {
 	firstRun     bool
 	lastCallTime time.Time
 	rateLimit    time.Duration
+	changeFields []string
+	namespaces   map[string]bool
+	cluster      string
+	region       string
+
+	checkpoints        CheckpointStore
+	savedCheckpoint    Checkpoint
+	pendingCheckpoints []pendingCheckpoint
+	writeFailed        bool
+
+	initialState string
+	emitSnapshot bool
 }
 
 // NewBaseManager creates a new base manager
-func NewBaseManager(nomadAddr, nomadToken string, sinks []Sink, eventType string, rateLimit time.Duration) (*BaseManager, error) {
-	config := nomadapi.DefaultConfig()
-	config.Address = nomadAddr
-	if nomadToken != "" {
-		config.SecretID = nomadToken
-	}
+func NewBaseManager(config ManagerConfig, eventType string, rateLimit time.Duration) (*BaseManager, error) {
+	// Every query made by the client is scoped to the watched namespaces
+	queryNamespace, namespaces := namespaceQuery(config.Namespaces)
 
-	client, err := nomadapi.NewClient(config)
+	client, err := newNomadClient(config.Cluster, queryNamespace)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Nomad client: %w", err)
+		return nil, err
 	}
 
 	return &BaseManager{
-		nomadClient: client,
-		sinks:       sinks,
-		eventType:   eventType,
-		stopChan:    make(chan struct{}),
-		lastIndex:   0,
-		logger:      GetLogger(),
-		firstRun:    true,
-		rateLimit:   rateLimit,
+		nomadClient:  client,
+		sinks:        config.Sinks,
+		eventType:    eventType,
+		stopChan:     make(chan struct{}),
+		lastIndex:    0,
+		logger:       GetLogger(),
+		firstRun:     true,
+		rateLimit:    rateLimit,
+		changeFields: config.ChangeFields[eventType],
+		namespaces:   namespaces,
+		cluster:      config.Cluster.Label,
+		region:       config.Cluster.Region,
+		checkpoints:  config.Checkpoints,
+		initialState: config.InitialState,
 	}, nil
 }
 
+// newNomadClient creates a Nomad client for the cluster, scoped to the
+// namespace when one is given
+func newNomadClient(cluster ClusterConfig, namespace string) (*nomadapi.Client, error) {
+	clientConfig := nomadapi.DefaultConfig()
+	clientConfig.Address = cluster.Address
+	if cluster.Token != "" {
+		clientConfig.SecretID = cluster.Token
+	}
+	if cluster.Region != "" {
+		clientConfig.Region = cluster.Region
+	}
+	if namespace != "" {
+		clientConfig.Namespace = namespace
+	}
+	applyTLSConfig(clientConfig.TLSConfig, cluster.TLS)
+
+	client, err := nomadapi.NewClient(clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Nomad client: %w", err)
+	}
+
+	return client, nil
+}
+
+// applyTLSConfig overrides the client TLS settings with the configured ones
+func applyTLSConfig(tlsConfig *nomadapi.TLSConfig, config TLSConfig) {
+	if config.CACert != "" {
+		tlsConfig.CACert = config.CACert
+	}
+	if config.ClientCert != "" {
+		tlsConfig.ClientCert = config.ClientCert
+	}
+	if config.ClientKey != "" {
+		tlsConfig.ClientKey = config.ClientKey
+	}
+	if config.ServerName != "" {
+		tlsConfig.TLSServerName = config.ServerName
+	}
+	if config.Insecure {
+		tlsConfig.Insecure = true
+	}
+}
+
+// namespaceQuery returns the namespace to query and, when several explicit
+// namespaces are watched, the set used to filter the query results
+func namespaceQuery(namespaces []string) (string, map[string]bool) {
+	switch {
+	case len(namespaces) == 0:
+		return "", nil
+	case slices.Contains(namespaces, nomadapi.AllNamespacesNamespace):
+		return nomadapi.AllNamespacesNamespace, nil
+	case len(namespaces) == 1:
+		return namespaces[0], nil
+	}
+
+	set := make(map[string]bool, len(namespaces))
+	for _, namespace := range namespaces {
+		set[namespace] = true
+	}
+	return nomadapi.AllNamespacesNamespace, set
+}
+
+// watchesNamespace returns whether objects in the namespace should be processed
+func (m *BaseManager) watchesNamespace(namespace string) bool {
+	return m.namespaces == nil || m.namespaces[namespace]
+}
+
 // GetEventType returns the event type this manager handles
 func (m *BaseManager) GetEventType() string {
 	return m.eventType
@@ -67,22 +164,24 @@ func (m *BaseManager) WriteEvent(event *Event) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	// Stamp the event with the cluster it was collected from
+	event.Cluster = m.cluster
+	event.Region = m.region
+
 	for _, sink := range m.sinks {
 		if err := sink.Write(event); err != nil {
 			m.logger.Error("Failed to write event to sink",
 				"event_type", m.eventType,
 				"error", err.Error(),
 			)
+			m.writeFailed = true
 		}
 	}
 	return nil
 }
 
-// Stop stops the manager
+// Stop stops the manager and waits for its watcher to exit
 func (m *BaseManager) Stop() error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	close(m.stopChan)
 	m.wg.Wait()
 	return nil
@@ -90,10 +189,14 @@ func (m *BaseManager) Stop() error {
 
 // runWatcherWithRateLimit provides a common rate limiting wrapper for all managers
 func (m *BaseManager) runWatcherWithRateLimit(ctx context.Context, watchFunc func(context.Context) error) {
+	m.resolveRegion()
+
 	for {
 		select {
 		case <-m.stopChan:
 			return
+		case <-ctx.Done():
+			return
 		default:
 		}
 
@@ -102,7 +205,7 @@ func (m *BaseManager) runWatcherWithRateLimit(ctx context.Context, watchFunc fun
 		if now.Sub(m.lastCallTime) < m.rateLimit {
 			// Wait for the remaining time
 			sleepDuration := m.rateLimit - now.Sub(m.lastCallTime)
-			time.Sleep(sleepDuration)
+			m.sleep(ctx, sleepDuration)
 			continue
 		}
 
@@ -110,22 +213,95 @@ func (m *BaseManager) runWatcherWithRateLimit(ctx context.Context, watchFunc fun
 		m.lastCallTime = now
 
 		if err := watchFunc(ctx); err != nil {
+			// Queries fail once the manager is being stopped
+			if ctx.Err() != nil {
+				return
+			}
+
 			m.logger.Error("Watcher error, retrying in 5 seconds",
 				"event_type", m.eventType,
 				"error", err.Error(),
 			)
-			time.Sleep(5 * time.Second)
+			m.sleep(ctx, 5*time.Second)
 		}
 	}
 }
 
-// markFirstRunComplete marks the first run as complete
+// sleep waits for the duration, returning early when the manager is stopped
+func (m *BaseManager) sleep(ctx context.Context, duration time.Duration) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-m.stopChan:
+	case <-ctx.Done():
+	}
+}
+
+// resolveRegion asks the agent for its region when none was configured
+func (m *BaseManager) resolveRegion() {
+	if m.region != "" {
+		return
+	}
+
+	region, err := m.nomadClient.Agent().Region()
+	if err != nil {
+		m.logger.Error("Failed to resolve cluster region",
+			"event_type", m.eventType,
+			"cluster", m.cluster,
+			"error", err.Error(),
+		)
+		return
+	}
+
+	m.mu.Lock()
+	m.region = region
+	m.mu.Unlock()
+}
+
+// prepareFirstRun decides whether the first poll emits the current state of
+// every object, based on the initial state mode and the restored checkpoint.
+// The snapshot is tracked apart from the first run, so a manager resuming
+// from a checkpoint still replays the changes made since then.
+func (m *BaseManager) prepareFirstRun(checkpoint *Checkpoint) {
+	switch m.initialState {
+	case InitialStateEmit:
+		// Always snapshot, even when resuming from a checkpoint
+		m.emitSnapshot = true
+	case InitialStateEmitOnce:
+		m.emitSnapshot = checkpoint == nil
+	default:
+		m.emitSnapshot = false
+	}
+}
+
+// snapshotPending returns whether the current poll should emit snapshot events
+func (m *BaseManager) snapshotPending() bool {
+	return m.emitSnapshot
+}
+
+// writeSnapshotEvent writes the current state of an object as a snapshot event
+func (m *BaseManager) writeSnapshotEvent(eventType string, data any) {
+	nomadEvent := NewEvent(eventType, data)
+	nomadEvent.Action = ActionSnapshot
+
+	if err := m.WriteEvent(nomadEvent); err != nil {
+		m.logger.Error("Failed to write snapshot event",
+			"event_type", eventType,
+			"error", err.Error(),
+		)
+	}
+}
+
+// markFirstRunComplete marks the first run and its snapshot as complete
 func (m *BaseManager) markFirstRunComplete() {
 	if m.firstRun {
 		m.logger.Info("First run completed, events will be processed on subsequent runs",
 			"event_type", m.eventType)
 		m.firstRun = false
 	}
+	m.emitSnapshot = false
 }
 
 // isFirstRun returns whether this is the first run
@@ -0,0 +1,207 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestNamespaceQuery(t *testing.T) {
+	tests := []struct {
+		name           string
+		namespaces     []string
+		expectedQuery  string
+		expectedFilter map[string]bool
+	}{
+		{
+			name:          "client default",
+			namespaces:    nil,
+			expectedQuery: "",
+		},
+		{
+			name:          "all namespaces",
+			namespaces:    []string{"*"},
+			expectedQuery: "*",
+		},
+		{
+			name:          "wildcard wins over explicit namespaces",
+			namespaces:    []string{"web", "*"},
+			expectedQuery: "*",
+		},
+		{
+			name:          "single namespace",
+			namespaces:    []string{"web"},
+			expectedQuery: "web",
+		},
+		{
+			name:           "explicit namespaces",
+			namespaces:     []string{"web", "batch"},
+			expectedQuery:  "*",
+			expectedFilter: map[string]bool{"web": true, "batch": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, filter := namespaceQuery(tt.namespaces)
+			if query != tt.expectedQuery {
+				t.Errorf("namespaceQuery() query = %q, want %q", query, tt.expectedQuery)
+			}
+			if !reflect.DeepEqual(filter, tt.expectedFilter) {
+				t.Errorf("namespaceQuery() filter = %v, want %v", filter, tt.expectedFilter)
+			}
+		})
+	}
+}
+
+func TestPrepareFirstRun(t *testing.T) {
+	tests := []struct {
+		name         string
+		initialState string
+		checkpoint   *Checkpoint
+		expected     bool
+	}{
+		{name: "skip", initialState: InitialStateSkip, expected: false},
+		{name: "default", initialState: "", expected: false},
+		{name: "emit", initialState: InitialStateEmit, expected: true},
+		{name: "emit with checkpoint", initialState: InitialStateEmit, checkpoint: &Checkpoint{Index: 10}, expected: true},
+		{name: "emit-once", initialState: InitialStateEmitOnce, expected: true},
+		{name: "emit-once with checkpoint", initialState: InitialStateEmitOnce, checkpoint: &Checkpoint{Index: 10}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &BaseManager{
+				firstRun:     true,
+				initialState: tt.initialState,
+				logger:       GetLogger(),
+			}
+
+			// Restoring a checkpoint marks the first run as complete
+			if tt.checkpoint != nil {
+				m.firstRun = false
+			}
+
+			m.prepareFirstRun(tt.checkpoint)
+			if got := m.snapshotPending(); got != tt.expected {
+				t.Errorf("snapshotPending() = %v, want %v", got, tt.expected)
+			}
+
+			// Changes since a restored checkpoint are still replayed
+			if tt.checkpoint != nil && m.isFirstRun() {
+				t.Error("Expected the first run to stay complete after restoring a checkpoint")
+			}
+
+			m.markFirstRunComplete()
+			if m.snapshotPending() {
+				t.Error("Expected no snapshot after the first poll")
+			}
+		})
+	}
+}
+
+// recordingSink keeps the events written to it
+type recordingSink struct {
+	events []*Event
+}
+
+func (s *recordingSink) Write(event *Event) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+func TestProcessAllocationTransitions(t *testing.T) {
+	var mu sync.Mutex
+	var reads []string
+	migrate := true
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/v1/allocation/")
+
+		mu.Lock()
+		reads = append(reads, id)
+		mu.Unlock()
+
+		mu.Lock()
+		migrate := migrate
+		mu.Unlock()
+
+		json.NewEncoder(w).Encode(&api.Allocation{
+			ID:                id,
+			DesiredTransition: api.DesiredTransition{Migrate: &migrate},
+		})
+	}))
+	defer server.Close()
+
+	sink := &recordingSink{}
+	m, err := NewAllocationManager(ManagerConfig{
+		Cluster: ClusterConfig{Address: server.URL},
+		Sinks:   []Sink{sink},
+	}, true, false)
+	if err != nil {
+		t.Fatalf("Failed to create allocation manager: %v", err)
+	}
+
+	running := &api.AllocationListStub{ID: "running", DesiredStatus: "run", ClientStatus: "running", ModifyIndex: 10}
+	stopped := &api.AllocationListStub{ID: "stopped", DesiredStatus: "stop", ClientStatus: "complete", ModifyIndex: 10}
+
+	// The first poll only tracks a baseline without reading transitions
+	m.processAllocationTransitions(context.Background(), []*api.AllocationListStub{running, stopped}, 0)
+	m.markFirstRunComplete()
+
+	if len(reads) != 0 {
+		t.Errorf("Expected no reads on the first poll, got %v", reads)
+	}
+	if len(sink.events) != 0 {
+		t.Errorf("Expected no events on the first poll, got %d", len(sink.events))
+	}
+
+	// A modification that reveals a transition that was never read is not
+	// reported, stopped allocations are not read
+	modified := *running
+	modified.ModifyIndex = 20
+	placed := &api.AllocationListStub{ID: "placed", DesiredStatus: "run", ClientStatus: "pending", ModifyIndex: 20}
+	stoppedModified := *stopped
+	stoppedModified.ModifyIndex = 20
+	m.processAllocationTransitions(context.Background(), []*api.AllocationListStub{&modified, &stoppedModified, placed}, 10)
+
+	slices.Sort(reads)
+	if !reflect.DeepEqual(reads, []string{"placed", "running"}) {
+		t.Errorf("Expected the modified and new allocations to be read, got %v", reads)
+	}
+	if len(sink.events) != 1 {
+		t.Fatalf("Expected 1 event for the new allocation, got %d", len(sink.events))
+	}
+
+	event := sink.events[0].Data.(*AllocationEvent)
+	if event.AllocationID != "placed" || event.Previous != nil || event.Current.DesiredTransition.Migrate == nil {
+		t.Errorf("Unexpected allocation event: %+v", event)
+	}
+
+	// Once read, a changed transition is reported
+	mu.Lock()
+	migrate = false
+	mu.Unlock()
+	modified.ModifyIndex = 30
+	m.processAllocationTransitions(context.Background(), []*api.AllocationListStub{&modified, &stoppedModified, placed}, 20)
+
+	if len(sink.events) != 2 {
+		t.Fatalf("Expected 2 events after the transition changed, got %d", len(sink.events))
+	}
+	event = sink.events[1].Data.(*AllocationEvent)
+	if event.AllocationID != "running" || event.Previous == nil || !*event.Previous.DesiredTransition.Migrate || *event.Current.DesiredTransition.Migrate {
+		t.Errorf("Unexpected allocation event: %+v", event)
+	}
+}
@@ -0,0 +1,353 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	// DefaultMetricsAddress is the address the metrics endpoint listens on
+	DefaultMetricsAddress = ":9464"
+
+	// DefaultMetricsPath is the path of the metrics endpoint
+	DefaultMetricsPath = "/metrics"
+
+	// DefaultMetricsMaxSeries caps the label sets of every metric
+	DefaultMetricsMaxSeries = 10000
+
+	// MaxMetricsLabels caps the number of event labels of every metric
+	MaxMetricsLabels = 6
+
+	// metricsOverflowValue replaces the label values of new label sets once
+	// a metric reached its series limit
+	metricsOverflowValue = "other"
+)
+
+// DefaultMetricsLabels are the event fields used as metric labels by default
+var DefaultMetricsLabels = []string{FieldType, FieldNamespace, FieldJob}
+
+// metricsLabelFields are the event fields that can be used as labels. Fields
+// identifying single objects, such as allocation IDs, are left out as every
+// value would create new series.
+var metricsLabelFields = []string{
+	FieldType,
+	FieldAction,
+	FieldCluster,
+	FieldRegion,
+	FieldNamespace,
+	FieldJob,
+	FieldTaskGroup,
+	FieldTask,
+}
+
+// Event outcomes counted by the metrics sink
+const (
+	OutcomeTaskRestart      = "task_restart"
+	OutcomeOOMKill          = "oom_kill"
+	OutcomeAllocationFailed = "allocation_failed"
+	OutcomeDeploymentFailed = "deployment_failed"
+)
+
+// MetricsSink derives Prometheus metrics from the events written by the
+// managers and serves them over HTTP
+type MetricsSink struct {
+	config   MetricsConfig
+	server   *http.Server
+	listener net.Listener
+	logger   *slog.Logger
+
+	events   *boundedCounter
+	outcomes *boundedCounter
+	nodes    *prometheus.GaugeVec
+
+	// nodeStatus and deploymentStatus remember the last status of every
+	// object, so gauges and counters only change on transitions
+	nodeStatus       map[string]nodeState
+	deploymentStatus map[string]string
+	mu               sync.Mutex
+}
+
+// nodeState is the last known status of a node
+type nodeState struct {
+	cluster string
+	status  string
+}
+
+// NewMetricsSink creates the metrics endpoint. The node gauge is only
+// exported when node events are collected, as nothing else keeps it current.
+func NewMetricsSink(config MetricsConfig, trackNodes bool) (*MetricsSink, error) {
+	if config.Address == "" {
+		config.Address = DefaultMetricsAddress
+	}
+	if config.Path == "" {
+		config.Path = DefaultMetricsPath
+	}
+	if len(config.Labels) == 0 {
+		config.Labels = DefaultMetricsLabels
+	}
+	if config.MaxSeries <= 0 {
+		config.MaxSeries = DefaultMetricsMaxSeries
+	}
+	if err := validateMetricsLabels(config.Labels); err != nil {
+		return nil, err
+	}
+
+	s := &MetricsSink{
+		config:           config,
+		logger:           GetLogger(),
+		nodeStatus:       make(map[string]nodeState),
+		deploymentStatus: make(map[string]string),
+	}
+
+	registry := prometheus.NewRegistry()
+
+	s.events = newBoundedCounter(registry, prometheus.CounterOpts{
+		Name: "nomad_events_total",
+		Help: "Number of Nomad events observed by the agent.",
+	}, config.Labels, nil, config.MaxSeries)
+
+	s.outcomes = newBoundedCounter(registry, prometheus.CounterOpts{
+		Name: "nomad_event_outcomes_total",
+		Help: "Number of task restarts, OOM kills, failed allocations and failed deployments.",
+	}, config.Labels, []string{"outcome"}, config.MaxSeries)
+
+	if trackNodes {
+		s.nodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nomad_nodes",
+			Help: "Number of nodes by status.",
+		}, []string{"cluster", "status"})
+		registry.MustRegister(s.nodes)
+	}
+
+	listener, err := net.Listen("tcp", config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", config.Address, err)
+	}
+	s.listener = listener
+
+	mux := http.NewServeMux()
+	mux.Handle(config.Path, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Metrics server failed",
+				"address", config.Address,
+				"error", err.Error(),
+			)
+		}
+	}()
+
+	s.logger.Info("Serving metrics",
+		"address", listener.Addr().String(),
+		"path", config.Path,
+	)
+
+	return s, nil
+}
+
+// validateMetricsLabels checks that the labels are low-cardinality event
+// fields and that the label count stays within MaxMetricsLabels
+func validateMetricsLabels(labels []string) error {
+	for _, label := range labels {
+		if !slices.Contains(metricsLabelFields, label) {
+			return fmt.Errorf("unsupported metrics label field %s, use one of %s", label, strings.Join(metricsLabelFields, ", "))
+		}
+	}
+
+	if len(labels) > MaxMetricsLabels {
+		return fmt.Errorf("metrics are limited to %d labels, got %d", MaxMetricsLabels, len(labels))
+	}
+
+	return nil
+}
+
+// Write updates the metrics from the event. Snapshot events only update the
+// node and deployment state, as they do not describe a change.
+func (s *MetricsSink) Write(event *Event) error {
+	labels := make([]string, len(s.config.Labels))
+	for i, field := range s.config.Labels {
+		labels[i] = event.Field(field)
+	}
+
+	s.events.Inc(labels)
+
+	s.mu.Lock()
+	outcome := s.outcome(event)
+	s.mu.Unlock()
+
+	if outcome != "" {
+		s.outcomes.Inc(labels, outcome)
+	}
+
+	return nil
+}
+
+// outcome updates the tracked object state and returns the outcome the
+// event represents, if any
+func (s *MetricsSink) outcome(event *Event) string {
+	live := event.Action != ActionSnapshot
+
+	switch data := event.Data.(type) {
+	case *TaskEvent:
+		if !live || data.TaskEvent == nil {
+			return ""
+		}
+		if data.TaskEvent.Details["oom_killed"] == "true" {
+			return OutcomeOOMKill
+		}
+		if data.TaskEvent.Type == api.TaskRestarting {
+			return OutcomeTaskRestart
+		}
+	case *AllocationEvent:
+		if !live || data.Current == nil || data.Current.ClientStatus != api.AllocClientStatusFailed {
+			return ""
+		}
+		if data.Previous == nil || data.Previous.ClientStatus != api.AllocClientStatusFailed {
+			return OutcomeAllocationFailed
+		}
+	case *api.Deployment:
+		if event.Action == ActionDeleted {
+			delete(s.deploymentStatus, data.ID)
+			return ""
+		}
+
+		previous := s.deploymentStatus[data.ID]
+		s.deploymentStatus[data.ID] = data.Status
+		if live && data.Status == api.DeploymentStatusFailed && previous != api.DeploymentStatusFailed {
+			return OutcomeDeploymentFailed
+		}
+	case *api.NodeListStub:
+		s.updateNode(event.Cluster, data.ID, data.Status, event.Action == ActionDeleted)
+	}
+
+	return ""
+}
+
+// updateNode moves the node between the status gauges
+func (s *MetricsSink) updateNode(cluster, id, status string, deleted bool) {
+	if s.nodes == nil {
+		return
+	}
+
+	key := cluster + "/" + id
+
+	if previous, ok := s.nodeStatus[key]; ok {
+		s.nodes.WithLabelValues(previous.cluster, previous.status).Dec()
+		delete(s.nodeStatus, key)
+	}
+
+	if deleted {
+		return
+	}
+
+	s.nodeStatus[key] = nodeState{cluster: cluster, status: status}
+	s.nodes.WithLabelValues(cluster, status).Inc()
+}
+
+// SeedNodes sets the node gauges from the current nodes of every cluster,
+// as node events only report changes. It runs before the managers start, so
+// the gauges are complete without a snapshot.
+func (s *MetricsSink) SeedNodes(ctx context.Context, clusters []ClusterConfig) error {
+	if s.nodes == nil {
+		return nil
+	}
+
+	current := make(map[string]nodeState)
+	for _, cluster := range clusters {
+		client, err := newNomadClient(cluster, "")
+		if err != nil {
+			return err
+		}
+
+		nodes, _, err := client.Nodes().List((&api.QueryOptions{}).WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("failed to list nodes of cluster %s: %w", cluster.Label, err)
+		}
+
+		for _, node := range nodes {
+			current[cluster.Label+"/"+node.ID] = nodeState{cluster: cluster.Label, status: node.Status}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nodes.Reset()
+	s.nodeStatus = current
+	for _, node := range current {
+		s.nodes.WithLabelValues(node.cluster, node.status).Inc()
+	}
+
+	return nil
+}
+
+func (s *MetricsSink) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.server.Shutdown(ctx)
+}
+
+// boundedCounter is a counter vector that stops creating series once it
+// has maxSeries label sets. Further label sets are counted under the
+// "other" value of every event label.
+type boundedCounter struct {
+	vec       *prometheus.CounterVec
+	maxSeries int
+	series    map[string]bool
+	overflow  bool
+	name      string
+	mu        sync.Mutex
+}
+
+func newBoundedCounter(registry *prometheus.Registry, opts prometheus.CounterOpts, labels, extra []string, maxSeries int) *boundedCounter {
+	vec := prometheus.NewCounterVec(opts, append(append([]string(nil), labels...), extra...))
+	registry.MustRegister(vec)
+
+	return &boundedCounter{
+		vec:       vec,
+		maxSeries: maxSeries,
+		series:    make(map[string]bool),
+		name:      opts.Name,
+	}
+}
+
+// Inc increments the series of the event label values and extra values
+func (c *boundedCounter) Inc(labels []string, extra ...string) {
+	values := append(append([]string(nil), labels...), extra...)
+	key := strings.Join(values, "\x00")
+
+	c.mu.Lock()
+	if !c.series[key] {
+		if len(c.series) >= c.maxSeries {
+			for i := range labels {
+				values[i] = metricsOverflowValue
+			}
+			if !c.overflow {
+				c.overflow = true
+				GetLogger().Error("Metric reached its series limit, counting new label sets as other",
+					"metric", c.name,
+					"max_series", c.maxSeries,
+				)
+			}
+		} else {
+			c.series[key] = true
+		}
+	}
+	c.mu.Unlock()
+
+	c.vec.WithLabelValues(values...).Inc()
+}
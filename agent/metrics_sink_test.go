@@ -0,0 +1,182 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// scrapeMetrics returns the metrics served by the sink
+func scrapeMetrics(t *testing.T, sink *MetricsSink) string {
+	resp, err := http.Get("http://" + sink.listener.Addr().String() + DefaultMetricsPath)
+	if err != nil {
+		t.Fatalf("Failed to scrape metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read metrics: %v", err)
+	}
+	return string(body)
+}
+
+func TestMetricsSink(t *testing.T) {
+	sink, err := NewMetricsSink(MetricsConfig{Address: "127.0.0.1:0"}, true)
+	if err != nil {
+		t.Fatalf("Failed to create metrics sink: %v", err)
+	}
+	defer sink.Close()
+
+	oomKill := NewEvent(EventTypeTask, &TaskEvent{
+		Namespace: "default",
+		JobID:     "web",
+		TaskEvent: &api.TaskEvent{Type: api.TaskTerminated, Details: map[string]string{"oom_killed": "true"}},
+	})
+	restart := NewEvent(EventTypeTask, &TaskEvent{
+		Namespace: "default",
+		JobID:     "web",
+		TaskEvent: &api.TaskEvent{Type: api.TaskRestarting},
+	})
+	failedAlloc := NewEvent(EventTypeAllocation, &AllocationEvent{
+		Namespace: "default",
+		JobID:     "web",
+		Previous:  &AllocationState{ClientStatus: api.AllocClientStatusRunning},
+		Current:   &AllocationState{ClientStatus: api.AllocClientStatusFailed},
+	})
+	runningDeployment := NewEvent(EventTypeDeployment, &api.Deployment{ID: "d-1", Namespace: "default", JobID: "api", Status: api.DeploymentStatusRunning})
+	failedDeployment := NewEvent(EventTypeDeployment, &api.Deployment{ID: "d-1", Namespace: "default", JobID: "api", Status: api.DeploymentStatusFailed})
+	// Modifying a failed deployment does not count it again
+	failedAgain := NewEvent(EventTypeDeployment, &api.Deployment{ID: "d-1", Namespace: "default", JobID: "api", Status: api.DeploymentStatusFailed})
+
+	snapshotNode := NewEvent(EventTypeNode, &api.NodeListStub{ID: "node-1", Status: api.NodeStatusReady})
+	snapshotNode.Action = ActionSnapshot
+	otherNode := NewEvent(EventTypeNode, &api.NodeListStub{ID: "node-2", Status: api.NodeStatusReady})
+	downNode := NewEvent(EventTypeNode, &api.NodeListStub{ID: "node-1", Status: api.NodeStatusDown})
+	deletedNode := NewEvent(EventTypeNode, &api.NodeListStub{ID: "node-2", Status: api.NodeStatusReady})
+	deletedNode.Action = ActionDeleted
+
+	events := []*Event{oomKill, restart, failedAlloc, runningDeployment, failedDeployment, failedAgain, snapshotNode, otherNode, downNode, deletedNode}
+	for _, event := range events {
+		if err := sink.Write(event); err != nil {
+			t.Fatalf("MetricsSink.Write() error = %v", err)
+		}
+	}
+
+	metrics := scrapeMetrics(t, sink)
+
+	for _, want := range []string{
+		`nomad_events_total{job="web",namespace="default",type="task"} 2`,
+		`nomad_events_total{job="api",namespace="default",type="deployment"} 3`,
+		`nomad_events_total{job="",namespace="",type="node"} 4`,
+		`nomad_event_outcomes_total{job="web",namespace="default",outcome="oom_kill",type="task"} 1`,
+		`nomad_event_outcomes_total{job="web",namespace="default",outcome="task_restart",type="task"} 1`,
+		`nomad_event_outcomes_total{job="web",namespace="default",outcome="allocation_failed",type="allocation"} 1`,
+		`nomad_event_outcomes_total{job="api",namespace="default",outcome="deployment_failed",type="deployment"} 1`,
+		`nomad_nodes{cluster="",status="down"} 1`,
+		`nomad_nodes{cluster="",status="ready"} 0`,
+	} {
+		if !strings.Contains(metrics, want+"\n") {
+			t.Errorf("Expected metrics to contain %s, got:\n%s", want, metrics)
+		}
+	}
+}
+
+func TestMetricsSink_MaxSeries(t *testing.T) {
+	sink, err := NewMetricsSink(MetricsConfig{
+		Address:   "127.0.0.1:0",
+		Labels:    []string{FieldJob},
+		MaxSeries: 2,
+	}, false)
+	if err != nil {
+		t.Fatalf("Failed to create metrics sink: %v", err)
+	}
+	defer sink.Close()
+
+	for _, job := range []string{"a", "b", "c", "d", "a"} {
+		sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: job}))
+	}
+
+	metrics := scrapeMetrics(t, sink)
+	for _, want := range []string{
+		`nomad_events_total{job="a"} 2`,
+		`nomad_events_total{job="b"} 1`,
+		`nomad_events_total{job="other"} 2`,
+	} {
+		if !strings.Contains(metrics, want+"\n") {
+			t.Errorf("Expected metrics to contain %s, got:\n%s", want, metrics)
+		}
+	}
+
+	// Without node events there is no node gauge to keep current
+	if strings.Contains(metrics, "nomad_nodes") {
+		t.Errorf("Expected no node gauge, got:\n%s", metrics)
+	}
+}
+
+func TestMetricsSink_SeedNodes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/nodes" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode([]*api.NodeListStub{
+			{ID: "node-1", Status: api.NodeStatusReady},
+			{ID: "node-2", Status: api.NodeStatusReady},
+			{ID: "node-3", Status: api.NodeStatusDown},
+		})
+	}))
+	defer server.Close()
+
+	sink, err := NewMetricsSink(MetricsConfig{Address: "127.0.0.1:0"}, true)
+	if err != nil {
+		t.Fatalf("Failed to create metrics sink: %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.SeedNodes(context.Background(), []ClusterConfig{{Label: "east", Address: server.URL}}); err != nil {
+		t.Fatalf("MetricsSink.SeedNodes() error = %v", err)
+	}
+
+	// Node events move seeded nodes between the gauges
+	event := NewEvent(EventTypeNode, &api.NodeListStub{ID: "node-3", Status: api.NodeStatusReady})
+	event.Cluster = "east"
+	sink.Write(event)
+
+	metrics := scrapeMetrics(t, sink)
+	for _, want := range []string{
+		`nomad_nodes{cluster="east",status="down"} 0`,
+		`nomad_nodes{cluster="east",status="ready"} 3`,
+	} {
+		if !strings.Contains(metrics, want+"\n") {
+			t.Errorf("Expected metrics to contain %s, got:\n%s", want, metrics)
+		}
+	}
+}
+
+func TestValidateMetricsLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  []string
+		wantErr bool
+	}{
+		{"defaults", DefaultMetricsLabels, false},
+		{"high cardinality field", []string{FieldAllocation}, true},
+		{"unknown field", []string{"status"}, true},
+		{"too many labels", []string{FieldType, FieldAction, FieldCluster, FieldRegion, FieldNamespace, FieldJob, FieldTask}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateMetricsLabels(tt.labels); (err != nil) != tt.wantErr {
+				t.Errorf("validateMetricsLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
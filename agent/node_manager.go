@@ -11,19 +11,29 @@ import (
 // NodeManager manages node events
 type NodeManager struct {
 	*BaseManager
+	tracker *objectTracker[*nomadapi.NodeListStub]
 }
 
-func NewNodeManager(nomadAddr, nomadToken string, sinks []Sink) (*NodeManager, error) {
-	baseManager, err := NewBaseManager(nomadAddr, nomadToken, sinks, EventTypeNode, 0) // No rate limit for nodes
+func NewNodeManager(config ManagerConfig) (*NodeManager, error) {
+	baseManager, err := NewBaseManager(config, EventTypeNode, 0) // No rate limit for nodes
 	if err != nil {
 		return nil, err
 	}
 	return &NodeManager{
 		BaseManager: baseManager,
+		tracker:     newObjectTracker[*nomadapi.NodeListStub](),
 	}, nil
 }
 
 func (m *NodeManager) Start(ctx context.Context) error {
+	checkpoint := m.restoreCheckpoint()
+	if checkpoint != nil {
+		m.tracker.Restore(checkpoint.Objects, func(id string) *nomadapi.NodeListStub {
+			return &nomadapi.NodeListStub{ID: id}
+		})
+	}
+	m.prepareFirstRun(checkpoint)
+
 	m.wg.Add(1)
 	go func() {
 		defer m.wg.Done()
@@ -46,13 +56,21 @@ func (m *NodeManager) watchNodes(ctx context.Context) error {
 	}
 
 	// Get nodes with blocking query
-	nodes, meta, err := m.nomadClient.Nodes().List(opts)
+	nodes, meta, err := m.nomadClient.Nodes().List(opts.WithContext(ctx))
 	if err != nil {
 		return fmt.Errorf("failed to get nodes: %w", err)
 	}
 
 	// Process nodes
+	current := make(map[string]*nomadapi.NodeListStub, len(nodes))
 	for _, node := range nodes {
+		current[node.ID] = node
+
+		// Emit the current state on the first run when requested
+		if m.snapshotPending() {
+			m.writeSnapshotEvent(EventTypeNode, node)
+		}
+
 		// Skip event output on first run
 		if m.isFirstRun() {
 			continue
@@ -63,7 +81,13 @@ func (m *NodeManager) watchNodes(ctx context.Context) error {
 			continue
 		}
 
-		nomadEvent := NewEvent(EventTypeNode, node)
+		// Attach the field changes since the previously seen version
+		previous, known := m.tracker.Get(node.ID)
+		nomadEvent := m.newChangeEvent(previous, node, known)
+		if nomadEvent == nil {
+			continue
+		}
+
 		if err := m.WriteEvent(nomadEvent); err != nil {
 			m.logger.Error("Failed to write node event",
 				"error", err.Error(),
@@ -71,6 +95,11 @@ func (m *NodeManager) watchNodes(ctx context.Context) error {
 		}
 	}
 
+	// Nodes missing from the response have been garbage collected
+	if meta != nil {
+		writeDeletedEvents(m.BaseManager, m.tracker.Sync(current), meta.LastIndex)
+	}
+
 	// Update last index
 	if meta != nil && meta.LastIndex > m.lastIndex {
 		m.lastIndex = meta.LastIndex
@@ -79,5 +108,7 @@ func (m *NodeManager) watchNodes(ctx context.Context) error {
 	// Mark first run as complete after processing
 	m.markFirstRunComplete()
 
+	m.saveCheckpoint(Checkpoint{Index: m.lastIndex, Objects: m.checkpointObjects(m.tracker.IDs)})
+
 	return nil
 }
@@ -0,0 +1,386 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// OTLP protocols
+const (
+	OTLPProtocolGRPC = "grpc"
+	OTLPProtocolHTTP = "http/protobuf"
+)
+
+const (
+	// DefaultOTLPServiceName is the service.name resource attribute
+	DefaultOTLPServiceName = "nomad-event-logger"
+
+	// DefaultOTLPQueueSize is the number of events kept for retry after an
+	// export failed
+	DefaultOTLPQueueSize = 10000
+
+	// otlpScopeName is the instrumentation scope of every log record
+	otlpScopeName = "github.com/josegonzalez/nomad-event-logger"
+)
+
+// otlpResourceAttributes maps the event fields identifying where an event
+// happened to resource attributes
+var otlpResourceAttributes = []struct {
+	field     string
+	attribute string
+}{
+	{FieldCluster, "nomad.cluster"},
+	{FieldRegion, "nomad.region"},
+	{FieldNamespace, "nomad.namespace.name"},
+	{FieldJob, "nomad.job.id"},
+	{FieldNode, "nomad.node.id"},
+}
+
+// otlpLogAttributes maps the remaining event fields to log attributes
+var otlpLogAttributes = []struct {
+	field     string
+	attribute string
+}{
+	{FieldAllocation, "nomad.allocation.id"},
+	{FieldTaskGroup, "nomad.task_group.name"},
+	{FieldTask, "nomad.task.name"},
+	{FieldEvaluation, "nomad.evaluation.id"},
+	{FieldDeployment, "nomad.deployment.id"},
+}
+
+// otlpSeverities maps syslog severities to OTLP severity numbers
+var otlpSeverities = map[int]logspb.SeverityNumber{
+	syslogSeverityErr:     logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+	syslogSeverityWarning: logspb.SeverityNumber_SEVERITY_NUMBER_WARN,
+	syslogSeverityNotice:  logspb.SeverityNumber_SEVERITY_NUMBER_INFO2,
+	syslogSeverityInfo:    logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+}
+
+// OTLPSink exports events as OpenTelemetry log records to an OTLP endpoint
+// over gRPC or HTTP/protobuf. Batches that could not be exported are kept
+// in a bounded queue and sent again with the next flush.
+type OTLPSink struct {
+	config  OTLPConfig
+	batcher *eventBatcher
+	logger  *slog.Logger
+
+	// grpc transport
+	conn   *grpc.ClientConn
+	client collogspb.LogsServiceClient
+
+	// http/protobuf transport
+	httpClient *http.Client
+	logsURL    string
+}
+
+func NewOTLPSink(config OTLPConfig) (*OTLPSink, error) {
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("otlp endpoint is required")
+	}
+
+	if config.Protocol == "" {
+		config.Protocol = OTLPProtocolGRPC
+	}
+
+	if config.ServiceName == "" {
+		config.ServiceName = DefaultOTLPServiceName
+	}
+
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultOTLPQueueSize
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	tlsConfig, err := newClientTLSConfig(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &OTLPSink{
+		config: config,
+		logger: GetLogger(),
+	}
+
+	switch config.Protocol {
+	case OTLPProtocolGRPC:
+		creds := insecure.NewCredentials()
+		if tlsConfig != nil {
+			creds = credentials.NewTLS(tlsConfig)
+		}
+
+		s.conn, err = grpc.NewClient(config.Endpoint, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create otlp grpc client: %w", err)
+		}
+		s.client = collogspb.NewLogsServiceClient(s.conn)
+	case OTLPProtocolHTTP:
+		if !strings.HasPrefix(config.Endpoint, "http://") && !strings.HasPrefix(config.Endpoint, "https://") {
+			return nil, fmt.Errorf("otlp http endpoint must be an http:// or https:// URL")
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		s.httpClient = &http.Client{Timeout: config.Timeout, Transport: transport}
+		s.logsURL = strings.TrimSuffix(config.Endpoint, "/") + "/v1/logs"
+	default:
+		return nil, fmt.Errorf("unknown otlp protocol: %s", config.Protocol)
+	}
+
+	s.batcher = newEventBatcher("otlp", config.Batch, s.send)
+	s.batcher.maxQueued = config.QueueSize
+
+	return s, nil
+}
+
+func (s *OTLPSink) Write(event *Event) error {
+	return s.batcher.Add(event)
+}
+
+func (s *OTLPSink) Accepted() uint64 {
+	return s.batcher.Accepted()
+}
+
+func (s *OTLPSink) Delivered() uint64 {
+	return s.batcher.Delivered()
+}
+
+func (s *OTLPSink) Close() error {
+	err := s.batcher.Close()
+	if s.conn != nil {
+		if closeErr := s.conn.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// send exports a batch of events, retrying transient failures. Batches
+// that still fail stay queued in the batcher and are exported again with
+// the next flush, at the latest when the sink is closed.
+func (s *OTLPSink) send(events []*Event) error {
+	err := withRetry(s.config.Retry, func() error {
+		return s.export(events)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export %d events to otlp: %w", len(events), err)
+	}
+
+	return nil
+}
+
+// export sends the events in a single export request
+func (s *OTLPSink) export(events []*Event) error {
+	request, err := s.exportRequest(events)
+	if err != nil {
+		return err
+	}
+
+	var partial *collogspb.ExportLogsPartialSuccess
+	if s.client != nil {
+		partial, err = s.exportGRPC(request)
+	} else {
+		partial, err = s.exportHTTP(request)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Rejected records are not retried, the collector would reject them again
+	if partial.GetRejectedLogRecords() > 0 {
+		s.logger.Error("OTLP endpoint rejected log records",
+			"rejected", partial.GetRejectedLogRecords(),
+			"message", partial.GetErrorMessage(),
+		)
+	}
+
+	return nil
+}
+
+func (s *OTLPSink) exportGRPC(request *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsPartialSuccess, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+
+	if len(s.config.Headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(s.config.Headers))
+	}
+
+	resp, err := s.client.Export(ctx, request)
+	if err != nil {
+		switch status.Code(err) {
+		case codes.Canceled, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted,
+			codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+			return nil, retryable(fmt.Errorf("export failed: %w", err))
+		}
+		return nil, fmt.Errorf("export failed: %w", err)
+	}
+
+	return resp.GetPartialSuccess(), nil
+}
+
+func (s *OTLPSink) exportHTTP(request *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsPartialSuccess, error) {
+	body, err := proto.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal export request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.logsURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for name, value := range s.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := doHTTPRequest(s.httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, retryable(fmt.Errorf("failed to read export response: %w", err))
+	}
+
+	var exportResp collogspb.ExportLogsServiceResponse
+	if err := proto.Unmarshal(data, &exportResp); err != nil {
+		return nil, fmt.Errorf("failed to parse export response: %w", err)
+	}
+
+	return exportResp.GetPartialSuccess(), nil
+}
+
+// exportRequest groups the events into resources by the fields identifying
+// where they happened
+func (s *OTLPSink) exportRequest(events []*Event) (*collogspb.ExportLogsServiceRequest, error) {
+	request := &collogspb.ExportLogsServiceRequest{}
+	resources := make(map[string]*logspb.ScopeLogs)
+	observed := uint64(time.Now().UnixNano())
+
+	for _, event := range events {
+		record, err := otlpLogRecord(event)
+		if err != nil {
+			return nil, err
+		}
+		record.ObservedTimeUnixNano = observed
+
+		resource, key := s.resource(event)
+		scope, ok := resources[key]
+		if !ok {
+			scope = &logspb.ScopeLogs{
+				Scope: &commonpb.InstrumentationScope{Name: otlpScopeName},
+			}
+			resources[key] = scope
+			request.ResourceLogs = append(request.ResourceLogs, &logspb.ResourceLogs{
+				Resource:  resource,
+				ScopeLogs: []*logspb.ScopeLogs{scope},
+			})
+		}
+
+		scope.LogRecords = append(scope.LogRecords, record)
+	}
+
+	return request, nil
+}
+
+// resource returns the resource of the event and a key identifying it
+func (s *OTLPSink) resource(event *Event) (*resourcepb.Resource, string) {
+	resource := &resourcepb.Resource{
+		Attributes: []*commonpb.KeyValue{otlpAttribute("service.name", s.config.ServiceName)},
+	}
+
+	var key strings.Builder
+	for _, attr := range otlpResourceAttributes {
+		value := event.Field(attr.field)
+		key.WriteString(value + "\x00")
+		if value != "" {
+			resource.Attributes = append(resource.Attributes, otlpAttribute(attr.attribute, value))
+		}
+	}
+
+	return resource, key.String()
+}
+
+// otlpLogRecord converts the event into a log record whose body is the
+// event JSON
+func otlpLogRecord(event *Event) (*logspb.LogRecord, error) {
+	data, err := event.ToJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	severity, ok := otlpSeverities[syslogSeverity(event)]
+	if !ok {
+		severity = logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	}
+
+	eventName := "nomad." + event.Type
+	if event.Action != "" {
+		eventName += "." + event.Action
+	}
+
+	record := &logspb.LogRecord{
+		TimeUnixNano:   uint64(event.Time.UnixNano()),
+		SeverityNumber: severity,
+		SeverityText:   otlpSeverityText(severity),
+		Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: string(data)}},
+		Attributes: []*commonpb.KeyValue{
+			otlpAttribute("event.name", eventName),
+			otlpAttribute("nomad.event.type", event.Type),
+		},
+	}
+
+	if event.Action != "" {
+		record.Attributes = append(record.Attributes, otlpAttribute("nomad.event.action", event.Action))
+	}
+
+	for _, attr := range otlpLogAttributes {
+		if value := event.Field(attr.field); value != "" {
+			record.Attributes = append(record.Attributes, otlpAttribute(attr.attribute, value))
+		}
+	}
+
+	return record, nil
+}
+
+// otlpSeverityText returns the short name of the severity, e.g. WARN
+func otlpSeverityText(severity logspb.SeverityNumber) string {
+	switch {
+	case severity >= logspb.SeverityNumber_SEVERITY_NUMBER_ERROR:
+		return "ERROR"
+	case severity >= logspb.SeverityNumber_SEVERITY_NUMBER_WARN:
+		return "WARN"
+	default:
+		return "INFO"
+	}
+}
+
+func otlpAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
@@ -0,0 +1,318 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeLogsService records export requests, failing the first failures ones
+type fakeLogsService struct {
+	collogspb.UnimplementedLogsServiceServer
+
+	mu       sync.Mutex
+	failures int
+	requests []*collogspb.ExportLogsServiceRequest
+	metadata []metadata.MD
+}
+
+func (f *fakeLogsService) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failures > 0 {
+		f.failures--
+		return nil, status.Error(codes.Unavailable, "collector unavailable")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	f.requests = append(f.requests, req)
+	f.metadata = append(f.metadata, md)
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+// waitForFailures waits until the service has failed n exports
+func (f *fakeLogsService) waitForFailures(t *testing.T, n int) {
+	t.Helper()
+
+	f.mu.Lock()
+	remaining := f.failures - n
+	f.mu.Unlock()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		f.mu.Lock()
+		failures := f.failures
+		f.mu.Unlock()
+
+		if failures <= remaining {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d failed exports", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (f *fakeLogsService) Records() []*logspb.LogRecord {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var records []*logspb.LogRecord
+	for _, req := range f.requests {
+		for _, resource := range req.ResourceLogs {
+			for _, scope := range resource.ScopeLogs {
+				records = append(records, scope.LogRecords...)
+			}
+		}
+	}
+	return records
+}
+
+func newFakeOTLPServer(t *testing.T, service *fakeLogsService) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	server := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(server, service)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return listener.Addr().String()
+}
+
+// otlpAttributes returns the string attributes as a map
+func otlpAttributes(attributes []*commonpb.KeyValue) map[string]string {
+	values := make(map[string]string, len(attributes))
+	for _, attr := range attributes {
+		values[attr.Key] = attr.Value.GetStringValue()
+	}
+	return values
+}
+
+func TestOTLPSink_GRPC(t *testing.T) {
+	service := &fakeLogsService{}
+	endpoint := newFakeOTLPServer(t, service)
+
+	sink, err := NewOTLPSink(OTLPConfig{
+		Endpoint: endpoint,
+		Headers:  map[string]string{"x-tenant": "ops"},
+		Batch:    BatchConfig{Size: 10},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create otlp sink: %v", err)
+	}
+
+	task := NewEvent(EventTypeTask, &TaskEvent{
+		Namespace:    "prod",
+		JobID:        "web",
+		NodeID:       "node-1",
+		AllocationID: "alloc-1",
+		TaskGroup:    "frontend",
+		TaskName:     "nginx",
+		TaskEvent:    &api.TaskEvent{Type: api.TaskRestarting},
+	})
+	task.Cluster = "east"
+	task.Region = "us"
+	deployment := NewEvent(EventTypeDeployment, &api.Deployment{ID: "d-1", Namespace: "prod", JobID: "web", Status: api.DeploymentStatusFailed})
+	deployment.Cluster = "east"
+	node := NewEvent(EventTypeNode, &api.NodeListStub{ID: "node-2"})
+
+	for _, event := range []*Event{task, deployment, node} {
+		if err := sink.Write(event); err != nil {
+			t.Fatalf("OTLPSink.Write() error = %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("OTLPSink.Close() error = %v", err)
+	}
+
+	if len(service.requests) != 1 {
+		t.Fatalf("Expected 1 export request, got %d", len(service.requests))
+	}
+	if got := service.metadata[0].Get("x-tenant"); len(got) != 1 || got[0] != "ops" {
+		t.Errorf("Expected the x-tenant header, got %v", got)
+	}
+
+	resources := service.requests[0].ResourceLogs
+	if len(resources) != 3 {
+		t.Fatalf("Expected 3 resources, got %d", len(resources))
+	}
+
+	resource := otlpAttributes(resources[0].Resource.Attributes)
+	want := map[string]string{
+		"service.name":         DefaultOTLPServiceName,
+		"nomad.cluster":        "east",
+		"nomad.region":         "us",
+		"nomad.namespace.name": "prod",
+		"nomad.job.id":         "web",
+		"nomad.node.id":        "node-1",
+	}
+	for key, value := range want {
+		if resource[key] != value {
+			t.Errorf("Expected resource attribute %s=%q, got %q", key, value, resource[key])
+		}
+	}
+
+	records := service.Records()
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 log records, got %d", len(records))
+	}
+
+	attrs := otlpAttributes(records[0].Attributes)
+	if attrs["nomad.allocation.id"] != "alloc-1" || attrs["nomad.task.name"] != "nginx" || attrs["nomad.task_group.name"] != "frontend" {
+		t.Errorf("Unexpected task log attributes %v", attrs)
+	}
+	if attrs["event.name"] != "nomad.task" {
+		t.Errorf("Expected event.name nomad.task, got %q", attrs["event.name"])
+	}
+	if records[0].SeverityNumber != logspb.SeverityNumber_SEVERITY_NUMBER_WARN {
+		t.Errorf("Expected a WARN task record, got %v", records[0].SeverityNumber)
+	}
+	if records[1].SeverityNumber != logspb.SeverityNumber_SEVERITY_NUMBER_ERROR || records[1].SeverityText != "ERROR" {
+		t.Errorf("Expected an ERROR deployment record, got %v %q", records[1].SeverityNumber, records[1].SeverityText)
+	}
+	if records[0].TimeUnixNano != uint64(task.Time.UnixNano()) {
+		t.Errorf("Expected the event time, got %d", records[0].TimeUnixNano)
+	}
+}
+
+func TestOTLPSink_RetryQueue(t *testing.T) {
+	service := &fakeLogsService{failures: 1}
+	endpoint := newFakeOTLPServer(t, service)
+
+	sink, err := NewOTLPSink(OTLPConfig{
+		Endpoint:  endpoint,
+		QueueSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create otlp sink: %v", err)
+	}
+	defer sink.Close()
+
+	// The first export fails and the event is queued
+	if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: "web"})); err != nil {
+		t.Fatalf("OTLPSink.Write() error = %v", err)
+	}
+	service.waitForFailures(t, 1)
+	if sink.Delivered() != 0 {
+		t.Fatalf("Expected the failed event not to be delivered, got %d", sink.Delivered())
+	}
+
+	// The queued event is exported before the next batch
+	if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: "api"})); err != nil {
+		t.Fatalf("OTLPSink.Write() error = %v", err)
+	}
+	waitForDelivered(t, sink, 2)
+
+	if len(service.requests) != 2 {
+		t.Fatalf("Expected 2 successful exports, got %d", len(service.requests))
+	}
+	if got := len(service.Records()); got != 2 {
+		t.Errorf("Expected the queued and new events to be exported, got %d records", got)
+	}
+}
+
+func TestOTLPSink_ExportsQueueOnClose(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		wantErr  bool
+	}{
+		{name: "collector recovered", failures: 1},
+		{name: "collector unavailable", failures: 100, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &fakeLogsService{failures: tt.failures}
+			endpoint := newFakeOTLPServer(t, service)
+
+			sink, err := NewOTLPSink(OTLPConfig{Endpoint: endpoint})
+			if err != nil {
+				t.Fatalf("Failed to create otlp sink: %v", err)
+			}
+
+			// The export fails and the event is queued
+			if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: "web"})); err != nil {
+				t.Fatalf("OTLPSink.Write() error = %v", err)
+			}
+			service.waitForFailures(t, 1)
+
+			err = sink.Close()
+			if tt.wantErr && err == nil {
+				t.Error("Expected an error for the queued event that was not exported")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("OTLPSink.Close() error = %v", err)
+			}
+
+			exported := len(service.Records()) == 1
+			if exported == tt.wantErr {
+				t.Errorf("Expected the queued event to be exported on close: %v, got %v", !tt.wantErr, exported)
+			}
+		})
+	}
+}
+
+func TestOTLPSink_HTTP(t *testing.T) {
+	var request collogspb.ExportLogsServiceRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/logs" {
+			t.Errorf("Expected path /v1/logs, got %s", r.URL.Path)
+		}
+		if r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("Expected a protobuf body, got %s", r.Header.Get("Content-Type"))
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if err := proto.Unmarshal(body, &request); err != nil {
+			t.Errorf("Failed to decode export request: %v", err)
+		}
+
+		resp, _ := proto.Marshal(&collogspb.ExportLogsServiceResponse{})
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(resp)
+	}))
+	defer server.Close()
+
+	sink, err := NewOTLPSink(OTLPConfig{
+		Protocol: OTLPProtocolHTTP,
+		Endpoint: server.URL,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create otlp sink: %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: "web", Namespace: "default"})); err != nil {
+		t.Fatalf("OTLPSink.Write() error = %v", err)
+	}
+	waitForDelivered(t, sink, 1)
+
+	if len(request.ResourceLogs) != 1 {
+		t.Fatalf("Expected 1 resource, got %d", len(request.ResourceLogs))
+	}
+	record := request.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if attrs := otlpAttributes(record.Attributes); attrs["nomad.event.type"] != EventTypeJob {
+		t.Errorf("Expected nomad.event.type job, got %q", attrs["nomad.event.type"])
+	}
+}
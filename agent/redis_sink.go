@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultRedisStream appends every event type to its own stream
+const DefaultRedisStream = "nomad:events:{type}"
+
+// RedisSink appends events to Redis Streams with XADD
+type RedisSink struct {
+	config  RedisConfig
+	client  *redis.Client
+	batcher *eventBatcher
+}
+
+func NewRedisSink(config RedisConfig) (*RedisSink, error) {
+	if config.Address == "" {
+		return nil, fmt.Errorf("redis address is required")
+	}
+
+	if config.Stream == "" {
+		config.Stream = DefaultRedisStream
+	}
+
+	tlsConfig, err := newClientTLSConfig(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:      config.Address,
+		Username:  config.Username,
+		Password:  config.Password,
+		DB:        config.DB,
+		TLSConfig: tlsConfig,
+	})
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis %s: %w", config.Address, err)
+	}
+
+	s := &RedisSink{
+		config: config,
+		client: client,
+	}
+	s.batcher = newEventBatcher("redis", config.Batch, s.send)
+
+	return s, nil
+}
+
+func (s *RedisSink) Write(event *Event) error {
+	return s.batcher.Add(event)
+}
+
+func (s *RedisSink) Accepted() uint64 {
+	return s.batcher.Accepted()
+}
+
+func (s *RedisSink) Delivered() uint64 {
+	return s.batcher.Delivered()
+}
+
+// send appends a batch of events in a single pipeline
+func (s *RedisSink) send(events []*Event) error {
+	pipe := s.client.Pipeline()
+
+	for _, event := range events {
+		data, err := event.ToJSON()
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+
+		pipe.XAdd(context.Background(), &redis.XAddArgs{
+			Stream: ExpandEventTemplate(s.config.Stream, event),
+			MaxLen: s.config.MaxLen,
+			Approx: s.config.MaxLen > 0 && s.config.ApproximateTrim,
+			Values: []any{"type", event.Type, "event", data},
+		})
+	}
+
+	cmds, err := pipe.Exec(context.Background())
+	if err != nil {
+		failed := 0
+		for _, cmd := range cmds {
+			if cmd.Err() != nil {
+				failed++
+			}
+		}
+		err = fmt.Errorf("failed to append %d of %d events to redis: %w", failed, len(events), err)
+
+		// Replies from the server, such as a stream holding another type,
+		// fail again when retried. Connection failures are retryable.
+		var redisErr redis.Error
+		if errors.As(err, &redisErr) {
+			return err
+		}
+		return retryable(err)
+	}
+
+	return nil
+}
+
+func (s *RedisSink) Close() error {
+	err := s.batcher.Close()
+	if closeErr := s.client.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
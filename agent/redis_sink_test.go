@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestRedisSink(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireUserAuth("nomad", "s3cret")
+
+	sink, err := NewRedisSink(RedisConfig{
+		Address:         server.Addr(),
+		Username:        "nomad",
+		Password:        "s3cret",
+		Stream:          "nomad:{namespace}:{type}",
+		MaxLen:          2,
+		ApproximateTrim: false,
+		Batch:           BatchConfig{Size: 10},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create redis sink: %v", err)
+	}
+
+	for _, id := range []string{"web", "api", "db"} {
+		event := NewEvent(EventTypeJob, &api.JobListStub{ID: id, Namespace: "default"})
+		if err := sink.Write(event); err != nil {
+			t.Fatalf("RedisSink.Write() error = %v", err)
+		}
+	}
+	if err := sink.Write(NewEvent(EventTypeNode, &api.NodeListStub{ID: "node-1"})); err != nil {
+		t.Fatalf("RedisSink.Write() error = %v", err)
+	}
+
+	// Nothing is sent until the batch is flushed
+	if server.Exists("nomad:default:job") {
+		t.Fatal("Expected events to be batched")
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("RedisSink.Close() error = %v", err)
+	}
+
+	entries, err := server.Stream("nomad:default:job")
+	if err != nil {
+		t.Fatalf("Failed to read stream: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected the stream to be trimmed to 2 entries, got %d", len(entries))
+	}
+
+	values := entries[1].Values
+	if len(values) != 4 || values[0] != "type" || values[1] != EventTypeJob || values[2] != "event" {
+		t.Fatalf("Unexpected entry values %v", values)
+	}
+
+	var event struct {
+		Data struct {
+			ID string
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(values[3]), &event); err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if event.Data.ID != "db" {
+		t.Errorf("Expected the newest entry to be job db, got %q", event.Data.ID)
+	}
+
+	// Events without a namespace leave the placeholder empty
+	if entries, _ := server.Stream("nomad::node"); len(entries) != 1 {
+		t.Errorf("Expected 1 node entry, got %d", len(entries))
+	}
+}
+
+func TestNewRedisSink_ConnectionError(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("s3cret")
+
+	if _, err := NewRedisSink(RedisConfig{Address: server.Addr(), Password: "wrong"}); err == nil {
+		t.Error("Expected an authentication error")
+	}
+}
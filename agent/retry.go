@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// retryableError marks a failure that may succeed when retried
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// retryable wraps err so that withRetry retries it
+func retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err}
+}
+
+// isRetryable returns whether the error was marked as retryable
+func isRetryable(err error) bool {
+	var retryErr *retryableError
+	return errors.As(err, &retryErr)
+}
+
+// withRetry calls fn until it succeeds, fails with an error that is not
+// retryable, or the retries are exhausted. The backoff doubles after every
+// attempt, up to MaxBackoff.
+func withRetry(config RetryConfig, fn func() error) error {
+	backoff := config.InitialBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = fn()
+		if err == nil || !isRetryable(err) || attempt >= config.MaxRetries {
+			break
+		}
+
+		GetLogger().Error("Delivery failed, retrying",
+			"attempt", attempt+1,
+			"backoff", backoff.String(),
+			"error", err.Error(),
+		)
+
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if config.MaxBackoff > 0 && backoff > config.MaxBackoff {
+			backoff = config.MaxBackoff
+		}
+	}
+
+	return err
+}
+
+// doHTTPRequest sends the request and checks the response status. Transport
+// errors (including timeouts), 5xx and 429 responses are retryable.
+func doHTTPRequest(client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, retryable(fmt.Errorf("request failed: %w", err))
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	err = fmt.Errorf("unexpected response %s: %s", resp.Status, body)
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return nil, retryable(err)
+	}
+	return nil, err
+}
@@ -0,0 +1,485 @@
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 sink defaults
+const (
+	DefaultS3Endpoint      = "https://s3.amazonaws.com"
+	DefaultS3FlushSize     = 64 << 20
+	DefaultS3FlushInterval = 5 * time.Minute
+	DefaultS3PartSize      = 16 << 20
+)
+
+// maxQueuedS3Objects caps the objects kept for upload while the bucket is
+// unavailable
+const maxQueuedS3Objects = 100
+
+// S3Sink buffers events per partition and uploads them in the background as
+// compressed newline-delimited JSON objects. Objects that fail to upload are
+// kept and uploaded again on the next flush.
+type S3Sink struct {
+	config    S3Config
+	client    *minio.Client
+	extension string
+	buffers   map[string]*s3Buffer
+	uploads   []*s3Buffer
+	accepted  uint64
+	closed    bool
+	mu        sync.Mutex
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+
+	// lost is the first event of the oldest buffer that could not be
+	// compressed. It holds back the delivered count, so the checkpoint stays
+	// before the lost events and they are written again after a restart.
+	lost uint64
+
+	// ready wakes the uploader once an object is sealed
+	ready chan struct{}
+
+	// uploaded is signalled as the upload queue drains and after every
+	// upload attempt, waking writers waiting for room in the queue.
+	// attempts counts the attempts started and finished the attempts
+	// completed.
+	uploaded *sync.Cond
+	attempts uint64
+	finished uint64
+}
+
+// s3Buffer holds the compressed events of a single partition. Once sealed,
+// it has the key it is uploaded to.
+type s3Buffer struct {
+	partition string
+	key       string
+	created   time.Time
+	first     uint64
+	size      int64
+	data      bytes.Buffer
+	writer    io.WriteCloser
+}
+
+func NewS3Sink(config S3Config) (*S3Sink, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket is required")
+	}
+
+	if config.Endpoint == "" {
+		config.Endpoint = DefaultS3Endpoint
+	}
+	if config.FlushSize <= 0 {
+		config.FlushSize = DefaultS3FlushSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultS3FlushInterval
+	}
+	if config.PartSize <= 0 {
+		config.PartSize = DefaultS3PartSize
+	}
+
+	var extension string
+	switch config.Compression {
+	case "", "gzip":
+		config.Compression = "gzip"
+		extension = ".ndjson.gz"
+	case "zstd":
+		extension = ".ndjson.zst"
+	case "none":
+		extension = ".ndjson"
+	default:
+		return nil, fmt.Errorf("unknown s3 compression: %s", config.Compression)
+	}
+
+	client, err := newS3Client(config)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &S3Sink{
+		config:    config,
+		client:    client,
+		extension: extension,
+		buffers:   make(map[string]*s3Buffer),
+		stopChan:  make(chan struct{}),
+		ready:     make(chan struct{}, 1),
+	}
+	s.uploaded = sync.NewCond(&s.mu)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.run()
+	}()
+
+	return s, nil
+}
+
+// newS3Client creates the client for the configured endpoint. Without static
+// credentials, credentials are read from the environment, the shared AWS
+// credentials file or the instance metadata service.
+func newS3Client(config S3Config) (*minio.Client, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q, expected a URL such as https://s3.amazonaws.com", config.Endpoint)
+	}
+
+	var creds *credentials.Credentials
+	if config.AccessKey != "" {
+		creds = credentials.NewStaticV4(config.AccessKey, config.SecretKey, config.SessionToken)
+	} else {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{},
+		})
+	}
+
+	bucketLookup := minio.BucketLookupAuto
+	if config.PathStyle {
+		bucketLookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:        creds,
+		Secure:       endpoint.Scheme == "https",
+		Region:       config.Region,
+		BucketLookup: bucketLookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	return client, nil
+}
+
+func (s *S3Sink) Write(event *Event) error {
+	data, err := event.ToJSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// While the queue is full, wait for the next upload attempt to make room
+	if len(s.uploads) >= maxQueuedS3Objects && !s.closed {
+		next := s.attempts + 1
+		s.wake()
+		for len(s.uploads) >= maxQueuedS3Objects && s.finished < next {
+			s.uploaded.Wait()
+		}
+	}
+	if len(s.uploads) >= maxQueuedS3Objects {
+		return fmt.Errorf("s3 upload queue is full, event dropped")
+	}
+
+	partition := s.partition(event)
+	buffer, ok := s.buffers[partition]
+	if !ok {
+		buffer, err = s.newBuffer(partition)
+		if err != nil {
+			return err
+		}
+		s.buffers[partition] = buffer
+	}
+
+	// A failed write leaves the compressed stream unusable, so the events
+	// buffered before are lost
+	if _, err := buffer.writer.Write(append(data, '\n')); err != nil {
+		delete(s.buffers, partition)
+		s.loseLocked(buffer)
+		return fmt.Errorf("failed to compress event: %w", err)
+	}
+	buffer.size += int64(len(data) + 1)
+
+	s.accepted++
+	if buffer.first == 0 {
+		buffer.first = s.accepted
+	}
+
+	if buffer.size < s.config.FlushSize {
+		return nil
+	}
+
+	if err := s.sealLocked(buffer); err != nil {
+		return err
+	}
+	s.wake()
+	return nil
+}
+
+// wake signals the uploader without waiting for it
+func (s *S3Sink) wake() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// loseLocked records that the events of the buffer can not be uploaded
+func (s *S3Sink) loseLocked(buffer *s3Buffer) {
+	if buffer.first != 0 && (s.lost == 0 || buffer.first < s.lost) {
+		s.lost = buffer.first
+	}
+}
+
+// Accepted returns the number of events buffered so far
+func (s *S3Sink) Accepted() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.accepted
+}
+
+// Delivered returns the number of events, in write order, before the oldest
+// event that has not been uploaded yet
+func (s *S3Sink) Delivered() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivered := s.accepted
+	for _, buffer := range s.buffers {
+		delivered = min(delivered, buffer.first-1)
+	}
+	for _, buffer := range s.uploads {
+		delivered = min(delivered, buffer.first-1)
+	}
+	if s.lost != 0 {
+		delivered = min(delivered, s.lost-1)
+	}
+	return delivered
+}
+
+// partition returns the Hive-style partition of the event, based on the
+// event time in UTC
+func (s *S3Sink) partition(event *Event) string {
+	t := event.Time.UTC()
+	return fmt.Sprintf("dt=%s/hour=%s/type=%s", t.Format("2006-01-02"), t.Format("15"), event.Type)
+}
+
+// newBuffer creates an empty buffer for the partition
+func (s *S3Sink) newBuffer(partition string) (*s3Buffer, error) {
+	buffer := &s3Buffer{
+		partition: partition,
+		created:   time.Now(),
+	}
+
+	switch s.config.Compression {
+	case "gzip":
+		buffer.writer = gzip.NewWriter(&buffer.data)
+	case "zstd":
+		writer, err := zstd.NewWriter(&buffer.data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+		buffer.writer = writer
+	default:
+		buffer.writer = nopWriteCloser{&buffer.data}
+	}
+
+	return buffer, nil
+}
+
+// run uploads sealed objects when woken, and flushes buffers once they
+// reach the flush interval, uploading the objects that failed to upload
+// before
+func (s *S3Sink) run() {
+	// Check often enough that buffers are flushed close to their deadline
+	ticker := time.NewTicker(min(s.config.FlushInterval/10+time.Millisecond, 10*time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-s.ready:
+		case <-ticker.C:
+			s.mu.Lock()
+			for _, buffer := range s.buffers {
+				if time.Since(buffer.created) < s.config.FlushInterval {
+					continue
+				}
+				if err := s.sealLocked(buffer); err != nil {
+					GetLogger().Error("Failed to flush events to s3",
+						"partition", buffer.partition,
+						"error", err.Error(),
+					)
+				}
+			}
+			s.mu.Unlock()
+		}
+
+		if err := s.uploadQueued(); err != nil {
+			GetLogger().Error("Failed to upload events to s3",
+				"error", err.Error(),
+			)
+		}
+	}
+}
+
+// sealLocked finishes the buffer and queues it for upload under a new key.
+// The key is kept across retries, so a retried upload that already
+// succeeded overwrites the same object. A buffer without a key stays
+// buffered and is sealed again later; one that could not be compressed is
+// lost and holds back the delivered count.
+func (s *S3Sink) sealLocked(buffer *s3Buffer) error {
+	key, err := s.objectKey(buffer.partition)
+	if err != nil {
+		return err
+	}
+
+	delete(s.buffers, buffer.partition)
+
+	if err := buffer.writer.Close(); err != nil {
+		s.loseLocked(buffer)
+		return fmt.Errorf("failed to compress events: %w", err)
+	}
+	buffer.key = key
+
+	s.uploads = append(s.uploads, buffer)
+	return nil
+}
+
+// uploadQueued uploads the queued objects, oldest first, until the queue
+// is empty or an upload fails. Objects failing with a retryable error stay
+// queued; other failures can not succeed later, so the object is dropped.
+// Only the uploader, or Close once it stopped, calls it.
+func (s *S3Sink) uploadQueued() error {
+	s.mu.Lock()
+	s.attempts++
+	attempt := s.attempts
+	s.mu.Unlock()
+
+	// Writers waiting for room give up once the attempt could not make any
+	defer func() {
+		s.mu.Lock()
+		s.finished = attempt
+		s.uploaded.Broadcast()
+		s.mu.Unlock()
+	}()
+
+	for {
+		s.mu.Lock()
+		if len(s.uploads) == 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		buffer := s.uploads[0]
+		s.mu.Unlock()
+
+		err := withRetry(s.config.Retry, func() error {
+			return s.upload(buffer)
+		})
+		if err != nil && isRetryable(err) {
+			return err
+		}
+
+		s.mu.Lock()
+		s.uploads = s.uploads[1:]
+		s.uploaded.Broadcast()
+		s.mu.Unlock()
+
+		if err != nil {
+			return fmt.Errorf("dropped object %s: %w", buffer.key, err)
+		}
+	}
+}
+
+// upload puts the object. Requests rejected by S3 with a client error, such
+// as a missing bucket or denied access, are not retryable.
+func (s *S3Sink) upload(buffer *s3Buffer) error {
+	// Objects larger than the part size are uploaded in parts
+	_, err := s.client.PutObject(context.Background(), s.config.Bucket, buffer.key,
+		bytes.NewReader(buffer.data.Bytes()), int64(buffer.data.Len()),
+		minio.PutObjectOptions{
+			ContentType: "application/x-ndjson",
+			PartSize:    uint64(s.config.PartSize),
+		},
+	)
+	if err == nil {
+		return nil
+	}
+
+	status := minio.ToErrorResponse(err).StatusCode
+	err = fmt.Errorf("failed to upload %s to s3: %w", buffer.key, err)
+
+	if status >= 400 && status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests {
+		return err
+	}
+	return retryable(err)
+}
+
+// objectKey returns a unique key for a new object of the partition
+func (s *S3Sink) objectKey(partition string) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to generate object key: %w", err)
+	}
+
+	prefix := s.config.Prefix
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return fmt.Sprintf("%s%s/%s-%s%s",
+		prefix,
+		partition,
+		time.Now().UTC().Format("20060102T150405Z"),
+		hex.EncodeToString(suffix),
+		s.extension,
+	), nil
+}
+
+// Close uploads every buffered event, failing when some of them could not
+// be uploaded
+func (s *S3Sink) Close() error {
+	close(s.stopChan)
+	s.wg.Wait()
+
+	s.mu.Lock()
+	s.closed = true
+	var errs []error
+	for _, buffer := range s.buffers {
+		if err := s.sealLocked(buffer); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.mu.Unlock()
+
+	if err := s.uploadQueued(); err != nil {
+		s.mu.Lock()
+		lost := len(s.uploads)
+		s.mu.Unlock()
+
+		errs = append(errs, fmt.Errorf("%d objects were not uploaded: %w", lost, err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// nopWriteCloser adds a no-op Close to a writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,292 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+	"github.com/klauspost/compress/zstd"
+)
+
+// fakeS3 records the objects uploaded with single part PUT requests
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	failures int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "unexpected request", http.StatusNotImplemented)
+		return
+	}
+
+	// Fail with a status the S3 client does not retry by itself
+	f.mu.Lock()
+	if f.failures > 0 {
+		f.failures--
+		f.mu.Unlock()
+		http.Error(w, "unavailable", http.StatusNotImplemented)
+		return
+	}
+	f.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		body = decodeAWSChunked(body)
+	}
+
+	f.mu.Lock()
+	f.objects[r.URL.Path] = body
+	f.mu.Unlock()
+
+	w.Header().Set("ETag", `"etag"`)
+}
+
+// decodeAWSChunked strips the chunk headers of a body uploaded with a
+// streaming signature, "<size>;chunk-signature=<signature>\r\n<data>\r\n"
+func decodeAWSChunked(body []byte) []byte {
+	var decoded []byte
+	for len(body) > 0 {
+		header, rest, _ := bytes.Cut(body, []byte("\r\n"))
+		sizeHex, _, _ := bytes.Cut(header, []byte(";"))
+		size, err := strconv.ParseInt(string(sizeHex), 16, 64)
+		if err != nil || size == 0 || int64(len(rest)) < size {
+			break
+		}
+		decoded = append(decoded, rest[:size]...)
+		body = bytes.TrimPrefix(rest[size:], []byte("\r\n"))
+	}
+	return decoded
+}
+
+func (f *fakeS3) Objects() map[string][]byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	objects := make(map[string][]byte, len(f.objects))
+	for key, value := range f.objects {
+		objects[key] = value
+	}
+	return objects
+}
+
+// waitForFailures waits until every planned failure was served
+func (f *fakeS3) waitForFailures(t *testing.T) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		f.mu.Lock()
+		failures := f.failures
+		f.mu.Unlock()
+		if failures == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d failed uploads", failures)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newTestS3Sink(t *testing.T, config S3Config) (*S3Sink, *fakeS3) {
+	t.Helper()
+
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	config.Endpoint = server.URL
+	config.Region = "us-east-1"
+	config.Bucket = "events"
+	config.AccessKey = "access"
+	config.SecretKey = "secret"
+	config.PathStyle = true
+
+	sink, err := NewS3Sink(config)
+	if err != nil {
+		t.Fatalf("Failed to create s3 sink: %v", err)
+	}
+	return sink, fake
+}
+
+func TestS3Sink(t *testing.T) {
+	sink, fake := newTestS3Sink(t, S3Config{Prefix: "nomad", Compression: "gzip"})
+
+	timestamp := time.Date(2026, 10, 16, 13, 30, 0, 0, time.UTC)
+	for _, eventType := range []string{EventTypeJob, EventTypeJob, EventTypeNode} {
+		event := NewEvent(eventType, &api.JobListStub{ID: "web"})
+		event.Time = timestamp
+		if err := sink.Write(event); err != nil {
+			t.Fatalf("S3Sink.Write() error = %v", err)
+		}
+	}
+
+	if objects := fake.Objects(); len(objects) != 0 {
+		t.Errorf("Expected no uploads before close, got %d", len(objects))
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("S3Sink.Close() error = %v", err)
+	}
+
+	objects := fake.Objects()
+	if len(objects) != 2 {
+		t.Fatalf("Expected one object per partition, got %d", len(objects))
+	}
+
+	keyPattern := regexp.MustCompile(`^/events/nomad/dt=2026-10-16/hour=13/type=(job|node)/\d{8}T\d{6}Z-[0-9a-f]{8}\.ndjson\.gz$`)
+	lines := make(map[string]int)
+	for key, data := range objects {
+		match := keyPattern.FindStringSubmatch(key)
+		if match == nil {
+			t.Errorf("Unexpected object key %s", key)
+			continue
+		}
+
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to decompress %s: %v", key, err)
+		}
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			lines[match[1]]++
+		}
+	}
+
+	if lines[EventTypeJob] != 2 || lines[EventTypeNode] != 1 {
+		t.Errorf("Expected 2 job and 1 node lines, got %v", lines)
+	}
+}
+
+func TestS3Sink_FlushThresholds(t *testing.T) {
+	sink, fake := newTestS3Sink(t, S3Config{
+		Compression:   "zstd",
+		FlushSize:     1,
+		FlushInterval: time.Hour,
+	})
+	defer sink.Close()
+
+	// The flush size is reached by every event
+	if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: "web"})); err != nil {
+		t.Fatalf("S3Sink.Write() error = %v", err)
+	}
+	waitForDelivered(t, sink, 1)
+
+	objects := fake.Objects()
+	if len(objects) != 1 {
+		t.Fatalf("Expected the buffer to be uploaded once full, got %d objects", len(objects))
+	}
+
+	for _, data := range objects {
+		decoder, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Failed to create zstd reader: %v", err)
+		}
+		content, err := io.ReadAll(decoder)
+		decoder.Close()
+		if err != nil || !regexp.MustCompile(`^\{.*"type":"job".*\}\n$`).Match(content) {
+			t.Errorf("Unexpected object content %q, error %v", content, err)
+		}
+	}
+}
+
+func TestS3Sink_FlushInterval(t *testing.T) {
+	sink, fake := newTestS3Sink(t, S3Config{FlushInterval: 10 * time.Millisecond})
+	defer sink.Close()
+
+	if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: "web"})); err != nil {
+		t.Fatalf("S3Sink.Write() error = %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(fake.Objects()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the buffer to be uploaded after the flush interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestS3Sink_KeepsFailedUploads(t *testing.T) {
+	sink, fake := newTestS3Sink(t, S3Config{
+		Compression: "none",
+		FlushSize:   1,
+		Retry:       RetryConfig{MaxRetries: 1, InitialBackoff: time.Millisecond},
+	})
+	fake.failures = 2
+
+	if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: "web"})); err != nil {
+		t.Fatalf("S3Sink.Write() error = %v", err)
+	}
+	fake.waitForFailures(t)
+
+	if sink.Accepted() != 1 || sink.Delivered() != 0 {
+		t.Fatalf("Expected 1 accepted and 0 delivered events, got %d and %d", sink.Accepted(), sink.Delivered())
+	}
+	if len(fake.Objects()) != 0 {
+		t.Fatalf("Expected no objects, got %d", len(fake.Objects()))
+	}
+
+	// The failed object is uploaded before the next one
+	if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: "api"})); err != nil {
+		t.Fatalf("S3Sink.Write() error = %v", err)
+	}
+	waitForDelivered(t, sink, 2)
+	if len(fake.Objects()) != 2 {
+		t.Errorf("Expected 2 objects, got %d", len(fake.Objects()))
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("S3Sink.Close() error = %v", err)
+	}
+}
+
+// failingWriter fails every write and close, like a broken compressor
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("compressor failed") }
+func (failingWriter) Close() error              { return errors.New("compressor failed") }
+
+func TestS3Sink_HoldsLostBuffers(t *testing.T) {
+	sink, fake := newTestS3Sink(t, S3Config{Compression: "none", Retry: RetryConfig{MaxRetries: 0}})
+
+	if err := sink.Write(NewEvent(EventTypeNode, &api.JobListStub{ID: "web"})); err != nil {
+		t.Fatalf("S3Sink.Write() error = %v", err)
+	}
+
+	// The buffered node events can no longer be compressed
+	sink.mu.Lock()
+	for _, buffer := range sink.buffers {
+		buffer.writer = failingWriter{}
+	}
+	sink.mu.Unlock()
+
+	if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: "api"})); err != nil {
+		t.Fatalf("S3Sink.Write() error = %v", err)
+	}
+	if err := sink.Close(); err == nil {
+		t.Fatal("Expected an error for the lost buffer")
+	}
+
+	// The job object is uploaded, but the checkpoint stays before the lost
+	// node event
+	if len(fake.Objects()) != 1 {
+		t.Errorf("Expected 1 object, got %d", len(fake.Objects()))
+	}
+	if sink.Accepted() != 2 || sink.Delivered() != 0 {
+		t.Errorf("Expected 2 accepted and 0 delivered events, got %d and %d", sink.Accepted(), sink.Delivered())
+	}
+}
@@ -2,7 +2,6 @@ package agent
 
 import (
 	"fmt"
-	"os"
 	"sync"
 )
 
@@ -12,6 +11,24 @@ type Sink interface {
 	Close() error
 }
 
+// Reopener is implemented by sinks writing to local files, which reopen
+// their files on SIGHUP after an external tool rotated them
+type Reopener interface {
+	Reopen() error
+}
+
+// DeliveryTracker is implemented by sinks that deliver events after Write
+// returned. Managers only save a checkpoint once every event written before
+// it was delivered, so a restart replays the events that were still queued.
+type DeliveryTracker interface {
+	// Accepted returns the number of events written to the sink
+	Accepted() uint64
+
+	// Delivered returns the number of events, in write order, that were
+	// delivered or permanently rejected
+	Delivered() uint64
+}
+
 // StdoutSink writes events to stdout
 type StdoutSink struct {
 	mu sync.Mutex
@@ -37,44 +54,3 @@ func (s *StdoutSink) Write(event *Event) error {
 func (s *StdoutSink) Close() error {
 	return nil
 }
-
-// FileSink writes events to a file
-type FileSink struct {
-	file *os.File
-	mu   sync.Mutex
-}
-
-func NewFileSink(path string) (*FileSink, error) {
-	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file %s: %w", path, err)
-	}
-
-	return &FileSink{file: file}, nil
-}
-
-func (s *FileSink) Write(event *Event) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	data, err := event.ToJSON()
-	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
-	}
-
-	if _, err := s.file.Write(append(data, '\n')); err != nil {
-		return fmt.Errorf("failed to write to file: %w", err)
-	}
-
-	return s.file.Sync()
-}
-
-func (s *FileSink) Close() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if s.file != nil {
-		return s.file.Close()
-	}
-	return nil
-}
@@ -125,7 +125,7 @@ func TestFileSink(t *testing.T) {
 			}
 			defer os.Remove(tmpfile.Name())
 
-			sink, err := NewFileSink(tmpfile.Name())
+			sink, err := NewFileSink(FileConfig{Path: tmpfile.Name()})
 			if err != nil {
 				t.Fatalf("Failed to create file sink: %v", err)
 			}
@@ -169,7 +169,7 @@ func TestFileSink_AppendMode(t *testing.T) {
 	}
 	defer os.Remove(tmpfile.Name())
 
-	sink, err := NewFileSink(tmpfile.Name())
+	sink, err := NewFileSink(FileConfig{Path: tmpfile.Name()})
 	if err != nil {
 		t.Fatalf("Failed to create file sink: %v", err)
 	}
@@ -232,7 +232,7 @@ func TestFileSink_AppendMode(t *testing.T) {
 }
 
 func TestFileSink_InvalidPath(t *testing.T) {
-	_, err := NewFileSink("/invalid/path/test")
+	_, err := NewFileSink(FileConfig{Path: "/invalid/path/test"})
 	if err == nil {
 		t.Error("Expected error for invalid path, got nil")
 	}
@@ -246,7 +246,7 @@ func TestFileSink_Close(t *testing.T) {
 	}
 	defer os.Remove(tmpfile.Name())
 
-	sink, err := NewFileSink(tmpfile.Name())
+	sink, err := NewFileSink(FileConfig{Path: tmpfile.Name()})
 	if err != nil {
 		t.Fatalf("Failed to create file sink: %v", err)
 	}
@@ -312,7 +312,7 @@ func BenchmarkFileSink_Write(b *testing.B) {
 	}
 	defer os.Remove(tmpfile.Name())
 
-	sink, err := NewFileSink(tmpfile.Name())
+	sink, err := NewFileSink(FileConfig{Path: tmpfile.Name()})
 	if err != nil {
 		b.Fatalf("Failed to create file sink: %v", err)
 	}
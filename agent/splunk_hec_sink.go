@@ -0,0 +1,257 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Splunk HEC defaults
+const (
+	DefaultSplunkHECSource     = "nomad-event-logger"
+	DefaultSplunkHECSourceType = "nomad:{type}"
+)
+
+// splunkHECAckPollInterval is how often pending acknowledgements are checked
+const splunkHECAckPollInterval = time.Second
+
+// SplunkHECSink sends batches of events to the Splunk HTTP Event Collector
+type SplunkHECSink struct {
+	config   SplunkHECConfig
+	client   *http.Client
+	eventURL string
+	ackURL   string
+	channel  string
+	batcher  *eventBatcher
+
+	ackPollInterval time.Duration
+}
+
+// splunkHECEvent is the HEC envelope of an event
+type splunkHECEvent struct {
+	Time       json.Number `json:"time"`
+	Index      string      `json:"index,omitempty"`
+	Source     string      `json:"source,omitempty"`
+	SourceType string      `json:"sourcetype,omitempty"`
+	Event      *Event      `json:"event"`
+}
+
+type splunkHECResponse struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID *int64 `json:"ackId"`
+}
+
+type splunkHECAckResponse struct {
+	Acks map[string]bool `json:"acks"`
+}
+
+func NewSplunkHECSink(config SplunkHECConfig) (*SplunkHECSink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("splunk hec url is required")
+	}
+	if config.Token == "" {
+		return nil, fmt.Errorf("splunk hec token is required")
+	}
+
+	if config.Source == "" {
+		config.Source = DefaultSplunkHECSource
+	}
+	if config.SourceType == "" {
+		config.SourceType = DefaultSplunkHECSourceType
+	}
+	if config.AckTimeout <= 0 {
+		config.AckTimeout = time.Minute
+	}
+
+	tlsConfig, err := newClientTLSConfig(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	baseURL := strings.TrimSuffix(config.URL, "/")
+	s := &SplunkHECSink{
+		config:   config,
+		client:   &http.Client{Timeout: config.Timeout, Transport: transport},
+		eventURL: baseURL + "/services/collector/event",
+		ackURL:   baseURL + "/services/collector/ack",
+
+		ackPollInterval: splunkHECAckPollInterval,
+	}
+
+	// Acknowledgements are tracked per channel
+	if config.Ack {
+		if s.channel, err = newChannelID(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.batcher = newEventBatcher("splunk_hec", config.Batch, s.send)
+
+	return s, nil
+}
+
+func (s *SplunkHECSink) Write(event *Event) error {
+	return s.batcher.Add(event)
+}
+
+func (s *SplunkHECSink) Accepted() uint64 {
+	return s.batcher.Accepted()
+}
+
+func (s *SplunkHECSink) Delivered() uint64 {
+	return s.batcher.Delivered()
+}
+
+func (s *SplunkHECSink) Close() error {
+	return s.batcher.Close()
+}
+
+// send posts a batch of events. With indexer acknowledgement, the batch is
+// only delivered once Splunk confirms it was indexed and is sent again if
+// the acknowledgement does not arrive in time.
+func (s *SplunkHECSink) send(events []*Event) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, event := range events {
+		if err := encoder.Encode(s.envelope(event)); err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+	}
+
+	err := withRetry(s.config.Retry, func() error {
+		var response splunkHECResponse
+		if err := s.post(s.eventURL, body.Bytes(), &response); err != nil {
+			return err
+		}
+
+		if !s.config.Ack {
+			return nil
+		}
+		if response.AckID == nil {
+			return fmt.Errorf("splunk hec did not return an ack id, is indexer acknowledgement enabled for the token?")
+		}
+		return s.waitForAck(*response.AckID)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send %d events to splunk hec: %w", len(events), err)
+	}
+
+	return nil
+}
+
+// envelope wraps the event with the HEC metadata of its event type
+func (s *SplunkHECSink) envelope(event *Event) splunkHECEvent {
+	index, source, sourceType := s.config.Index, s.config.Source, s.config.SourceType
+	if target, ok := s.config.EventTypes[event.Type]; ok {
+		if target.Index != "" {
+			index = target.Index
+		}
+		if target.Source != "" {
+			source = target.Source
+		}
+		if target.SourceType != "" {
+			sourceType = target.SourceType
+		}
+	}
+
+	// HEC expects the epoch time in seconds, with millisecond precision
+	millis := occurredAt(event).UnixMilli()
+	return splunkHECEvent{
+		Time:       json.Number(fmt.Sprintf("%d.%03d", millis/1000, millis%1000)),
+		Index:      ExpandEventTemplate(index, event),
+		Source:     ExpandEventTemplate(source, event),
+		SourceType: ExpandEventTemplate(sourceType, event),
+		Event:      event,
+	}
+}
+
+// waitForAck polls the acknowledgement endpoint until the request was
+// indexed, returning a retryable error when the ack timeout expires
+func (s *SplunkHECSink) waitForAck(ackID int64) error {
+	body, err := json.Marshal(map[string][]int64{"acks": {ackID}})
+	if err != nil {
+		return fmt.Errorf("failed to marshal ack request: %w", err)
+	}
+
+	deadline := time.Now().Add(s.config.AckTimeout)
+	for {
+		time.Sleep(s.ackPollInterval)
+
+		var response splunkHECAckResponse
+		if err := s.post(s.ackURL, body, &response); err != nil && !isRetryable(err) {
+			return err
+		}
+
+		if response.Acks[strconv.FormatInt(ackID, 10)] {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return retryable(fmt.Errorf("events were not acknowledged within %s", s.config.AckTimeout))
+		}
+	}
+}
+
+// post sends an authenticated request and decodes the JSON response
+func (s *SplunkHECSink) post(url string, body []byte, response any) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Splunk "+s.config.Token)
+	if s.channel != "" {
+		req.Header.Set("X-Splunk-Request-Channel", s.channel)
+	}
+
+	resp, err := doHTTPRequest(s.client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// validateSplunkHECTemplates checks the index, source and sourcetype templates
+func validateSplunkHECTemplates(config SplunkHECConfig) error {
+	targets := []SplunkHECTarget{{Index: config.Index, Source: config.Source, SourceType: config.SourceType}}
+	for _, target := range config.EventTypes {
+		targets = append(targets, target)
+	}
+
+	for _, target := range targets {
+		for _, template := range []string{target.Index, target.Source, target.SourceType} {
+			if err := ValidateEventTemplate(template); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newChannelID returns a random UUID identifying the HEC channel
+func newChannelID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate channel id: %w", err)
+	}
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestSplunkHECSink(t *testing.T) {
+	var received []map[string]any
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Splunk token" {
+			t.Errorf("Expected Splunk token authorization, got %q", got)
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		for decoder.More() {
+			var event map[string]any
+			if err := decoder.Decode(&event); err != nil {
+				t.Errorf("Failed to decode event: %v", err)
+				return
+			}
+			received = append(received, event)
+		}
+		fmt.Fprint(w, `{"text":"Success","code":0}`)
+	}))
+	defer server.Close()
+
+	sink, err := NewSplunkHECSink(SplunkHECConfig{
+		URL:   server.URL,
+		Token: "token",
+		Index: "nomad",
+		EventTypes: map[string]SplunkHECTarget{
+			EventTypeNode: {Index: "infra", SourceType: "nomad:node:{cluster}"},
+		},
+		Batch: BatchConfig{Size: 2},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create splunk hec sink: %v", err)
+	}
+	defer sink.Close()
+
+	// Jobs are sent with their submit time, nodes with the observation time
+	job := NewEvent(EventTypeJob, &api.JobListStub{ID: "web", SubmitTime: time.UnixMilli(1700000000123).UnixNano()})
+	node := NewEvent(EventTypeNode, &api.NodeListStub{ID: "node-1"})
+	node.Time = time.UnixMilli(1700000100456)
+	node.Cluster = "east"
+
+	for _, event := range []*Event{job, node} {
+		if err := sink.Write(event); err != nil {
+			t.Fatalf("SplunkHECSink.Write() error = %v", err)
+		}
+	}
+	waitForDelivered(t, sink, 2)
+
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(received))
+	}
+
+	if received[0]["time"] != 1700000000.123 || received[0]["index"] != "nomad" ||
+		received[0]["source"] != DefaultSplunkHECSource || received[0]["sourcetype"] != "nomad:job" {
+		t.Errorf("Unexpected job event metadata: %v", received[0])
+	}
+	if received[1]["time"] != 1700000100.456 || received[1]["index"] != "infra" || received[1]["sourcetype"] != "nomad:node:east" {
+		t.Errorf("Unexpected node event metadata: %v", received[1])
+	}
+	if event, ok := received[0]["event"].(map[string]any); !ok || event["type"] != EventTypeJob {
+		t.Errorf("Expected the Nomad event as the HEC event, got %v", received[0]["event"])
+	}
+}
+
+func TestSplunkHECSink_Ack(t *testing.T) {
+	var channels []string
+	sends, polls := 0, 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		channels = append(channels, r.Header.Get("X-Splunk-Request-Channel"))
+
+		switch r.URL.Path {
+		case "/services/collector/event":
+			sends++
+			fmt.Fprintf(w, `{"text":"Success","code":0,"ackId":%d}`, sends)
+		case "/services/collector/ack":
+			polls++
+			body, _ := io.ReadAll(r.Body)
+			if !bytes.Equal(body, []byte(`{"acks":[1]}`)) {
+				t.Errorf("Unexpected ack request: %s", body)
+			}
+			// The events are indexed on the second poll
+			fmt.Fprintf(w, `{"acks":{"1":%t}}`, polls > 1)
+		}
+	}))
+	defer server.Close()
+
+	sink, err := NewSplunkHECSink(SplunkHECConfig{URL: server.URL, Token: "token", Ack: true})
+	if err != nil {
+		t.Fatalf("Failed to create splunk hec sink: %v", err)
+	}
+	sink.ackPollInterval = time.Millisecond
+	defer sink.Close()
+
+	if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: "web"})); err != nil {
+		t.Fatalf("SplunkHECSink.Write() error = %v", err)
+	}
+	waitForDelivered(t, sink, 1)
+
+	if sends != 1 || polls != 2 {
+		t.Errorf("Expected 1 send and 2 ack polls, got %d and %d", sends, polls)
+	}
+	for _, channel := range channels {
+		if channel == "" || channel != channels[0] {
+			t.Errorf("Expected every request on the same channel, got %v", channels)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package agent
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// SQL drivers
+const (
+	SQLDriverPostgres = "postgres"
+	SQLDriverSQLite   = "sqlite"
+)
+
+// DefaultSQLTable is the table events are written to
+const DefaultSQLTable = "nomad_events"
+
+// sqliteTimeFormat stores times as fixed width UTC text so they sort correctly
+const sqliteTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// sqlIdentifierPattern matches table names that are safe to use unquoted
+var sqlIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// sqlMigration is a schema version, as the statements applied to reach it
+type sqlMigration struct {
+	version  int
+	postgres []string
+	sqlite   []string
+}
+
+// sqlMigrations are applied in order on startup. {table} is replaced by the
+// configured table name. Released migrations must never change; add a new
+// version instead.
+var sqlMigrations = []sqlMigration{
+	{
+		version: 1,
+		postgres: []string{
+			`CREATE TABLE IF NOT EXISTS {table} (
+				id BIGSERIAL PRIMARY KEY,
+				time TIMESTAMPTZ NOT NULL,
+				type TEXT NOT NULL,
+				action TEXT,
+				cluster TEXT,
+				region TEXT,
+				namespace TEXT,
+				job TEXT,
+				node TEXT,
+				allocation TEXT,
+				task TEXT,
+				nomad_index BIGINT,
+				data JSONB,
+				changes JSONB
+			)`,
+			`CREATE INDEX IF NOT EXISTS {table}_time_idx ON {table} (time)`,
+			`CREATE INDEX IF NOT EXISTS {table}_type_time_idx ON {table} (type, time)`,
+			`CREATE INDEX IF NOT EXISTS {table}_job_time_idx ON {table} (namespace, job, time)`,
+		},
+		sqlite: []string{
+			`CREATE TABLE IF NOT EXISTS {table} (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				time TEXT NOT NULL,
+				type TEXT NOT NULL,
+				action TEXT,
+				cluster TEXT,
+				region TEXT,
+				namespace TEXT,
+				job TEXT,
+				node TEXT,
+				allocation TEXT,
+				task TEXT,
+				nomad_index INTEGER,
+				data TEXT,
+				changes TEXT
+			)`,
+			`CREATE INDEX IF NOT EXISTS {table}_time_idx ON {table} (time)`,
+			`CREATE INDEX IF NOT EXISTS {table}_type_time_idx ON {table} (type, time)`,
+			`CREATE INDEX IF NOT EXISTS {table}_job_time_idx ON {table} (namespace, job, time)`,
+		},
+	},
+}
+
+// SQLSink writes events to a PostgreSQL or SQLite table
+type SQLSink struct {
+	config  SQLConfig
+	db      *sql.DB
+	insert  string
+	batcher *eventBatcher
+}
+
+func NewSQLSink(config SQLConfig) (*SQLSink, error) {
+	if config.Table == "" {
+		config.Table = DefaultSQLTable
+	}
+	if !sqlIdentifierPattern.MatchString(config.Table) {
+		return nil, fmt.Errorf("invalid sql table name: %s", config.Table)
+	}
+
+	var driverName string
+	switch config.Driver {
+	case SQLDriverPostgres:
+		driverName = "pgx"
+	case SQLDriverSQLite:
+		driverName = "sqlite"
+	default:
+		return nil, fmt.Errorf("unknown sql driver: %s", config.Driver)
+	}
+
+	db, err := sql.Open(driverName, config.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// SQLite allows a single writer at a time
+	if config.Driver == SQLDriverSQLite {
+		db.SetMaxOpenConns(1)
+	}
+
+	s := &SQLSink{
+		config: config,
+		db:     db,
+		insert: sqlInsertStatement(config.Driver, config.Table),
+	}
+
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s.batcher = newEventBatcher("sql", config.Batch, s.send)
+
+	return s, nil
+}
+
+// migrate brings the schema up to the latest version, recording applied
+// versions in a migrations table next to the events table
+func (s *SQLSink) migrate() error {
+	migrationsTable := s.config.Table + "_schema_migrations"
+
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS ` + migrationsTable + ` (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	var current int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM ` + migrationsTable).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, migration := range sqlMigrations {
+		if migration.version <= current {
+			continue
+		}
+
+		statements := migration.postgres
+		if s.config.Driver == SQLDriverSQLite {
+			statements = migration.sqlite
+		}
+
+		tx, err := s.db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration: %w", err)
+		}
+
+		for _, statement := range statements {
+			if _, err := tx.Exec(strings.ReplaceAll(statement, "{table}", s.config.Table)); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to apply schema version %d: %w", migration.version, err)
+			}
+		}
+
+		record := `INSERT INTO ` + migrationsTable + ` (version) VALUES (` + sqlPlaceholder(s.config.Driver, 1) + `)`
+		if _, err := tx.Exec(record, migration.version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record schema version %d: %w", migration.version, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit schema version %d: %w", migration.version, err)
+		}
+
+		GetLogger().Info("Applied database schema migration",
+			"table", s.config.Table,
+			"version", migration.version,
+		)
+	}
+
+	return nil
+}
+
+// sqlInsertStatement returns the statement inserting a single event
+func sqlInsertStatement(driver, table string) string {
+	columns := []string{"time", "type", "action", "cluster", "region", "namespace", "job", "node", "allocation", "task", "nomad_index", "data", "changes"}
+
+	placeholders := make([]string, len(columns))
+	for i := range columns {
+		placeholders[i] = sqlPlaceholder(driver, i+1)
+	}
+
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+}
+
+// sqlPlaceholder returns the n-th bind parameter of the driver
+func sqlPlaceholder(driver string, n int) string {
+	if driver == SQLDriverPostgres {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+func (s *SQLSink) Write(event *Event) error {
+	return s.batcher.Add(event)
+}
+
+func (s *SQLSink) Accepted() uint64 {
+	return s.batcher.Accepted()
+}
+
+func (s *SQLSink) Delivered() uint64 {
+	return s.batcher.Delivered()
+}
+
+// send inserts a batch of events in a single transaction. Connection
+// failures are retryable, so the batcher sends the batch again once the
+// database is reachable.
+func (s *SQLSink) send(events []*Event) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return retryable(fmt.Errorf("failed to begin transaction: %w", err))
+	}
+
+	stmt, err := tx.Prepare(s.insert)
+	if err != nil {
+		tx.Rollback()
+		return sqlError(fmt.Errorf("failed to prepare insert: %w", err))
+	}
+
+	for _, event := range events {
+		args, err := s.row(event)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if _, err := stmt.Exec(args...); err != nil {
+			tx.Rollback()
+			return sqlError(fmt.Errorf("failed to insert event: %w", err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return retryable(fmt.Errorf("failed to commit %d events: %w", len(events), err))
+	}
+
+	return nil
+}
+
+// sqlError marks errors caused by a lost connection as retryable. Errors
+// reported by the database, such as constraint violations, are not.
+func sqlError(err error) error {
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr) {
+		return retryable(err)
+	}
+	return err
+}
+
+// row returns the column values of the event
+func (s *SQLSink) row(event *Event) ([]any, error) {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event data: %w", err)
+	}
+
+	var changes any
+	if len(event.Changes) > 0 {
+		encoded, err := json.Marshal(event.Changes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal event changes: %w", err)
+		}
+		changes = string(encoded)
+	}
+
+	var eventTime any = event.Time
+	if s.config.Driver == SQLDriverSQLite {
+		eventTime = event.Time.UTC().Format(sqliteTimeFormat)
+	}
+
+	return []any{
+		eventTime,
+		event.Type,
+		nullString(event.Action),
+		nullString(event.Cluster),
+		nullString(event.Region),
+		nullString(event.Namespace),
+		nullString(event.Field(FieldJob)),
+		nullString(event.Field(FieldNode)),
+		nullString(event.Field(FieldAllocation)),
+		nullString(event.Field(FieldTask)),
+		nullIndex(event.Index),
+		string(data),
+		changes,
+	}, nil
+}
+
+// nullString stores empty strings as NULL
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// nullIndex stores a missing Nomad index as NULL
+func nullIndex(index uint64) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(index), Valid: index != 0}
+}
+
+func (s *SQLSink) Close() error {
+	err := s.batcher.Close()
+	if closeErr := s.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
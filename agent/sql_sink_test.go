@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestSQLSink_SQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+
+	sink, err := NewSQLSink(SQLConfig{
+		Driver: SQLDriverSQLite,
+		DSN:    path,
+		Batch:  BatchConfig{Size: 10},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create sql sink: %v", err)
+	}
+
+	task := NewEvent(EventTypeTask, &TaskEvent{
+		Namespace:    "default",
+		JobID:        "web",
+		NodeID:       "node-1",
+		AllocationID: "alloc-1",
+		TaskName:     "nginx",
+		TaskEvent:    &api.TaskEvent{Type: api.TaskRestarting},
+	})
+	task.Time = time.Date(2026, 10, 16, 13, 0, 0, 0, time.UTC)
+
+	node := NewEvent(EventTypeNode, &api.NodeListStub{ID: "node-1", Status: "down"})
+	node.Changes = []Change{{Path: "Status", Old: "ready", New: "down"}}
+	node.Index = 42
+
+	for _, event := range []*Event{task, node} {
+		if err := sink.Write(event); err != nil {
+			t.Fatalf("SQLSink.Write() error = %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("SQLSink.Close() error = %v", err)
+	}
+
+	// Reopening the database does not apply the migrations again
+	sink, err = NewSQLSink(SQLConfig{Driver: SQLDriverSQLite, DSN: path})
+	if err != nil {
+		t.Fatalf("Failed to reopen sql sink: %v", err)
+	}
+	sink.Close()
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var eventTime, namespace, job, nodeID, allocation, taskName, data string
+	var taskIndex sql.NullInt64
+	err = db.QueryRow(`SELECT time, namespace, job, node, allocation, task, nomad_index, data FROM nomad_events WHERE type = 'task'`).
+		Scan(&eventTime, &namespace, &job, &nodeID, &allocation, &taskName, &taskIndex, &data)
+	if err != nil {
+		t.Fatalf("Failed to query task event: %v", err)
+	}
+
+	// The task event has no Nomad index
+	if eventTime != "2026-10-16T13:00:00.000000000Z" || namespace != "default" || job != "web" ||
+		nodeID != "node-1" || allocation != "alloc-1" || taskName != "nginx" || taskIndex.Valid {
+		t.Errorf("Unexpected task row: %s %s %s %s %s %s %v", eventTime, namespace, job, nodeID, allocation, taskName, taskIndex)
+	}
+
+	var restarts int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM nomad_events WHERE json_extract(data, '$.TaskEvent.Type') = 'Restarting'`).Scan(&restarts); err != nil || restarts != 1 {
+		t.Errorf("Expected the data column to hold the event data as JSON, got %d restarts, error %v", restarts, err)
+	}
+
+	var nodeJob sql.NullString
+	var index int64
+	var changes string
+	if err := db.QueryRow(`SELECT job, nomad_index, changes FROM nomad_events WHERE type = 'node'`).Scan(&nodeJob, &index, &changes); err != nil {
+		t.Fatalf("Failed to query node event: %v", err)
+	}
+	if nodeJob.Valid || index != 42 || changes != `[{"path":"Status","old":"ready","new":"down"}]` {
+		t.Errorf("Unexpected node row: %v %d %s", nodeJob, index, changes)
+	}
+
+	var versions int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM nomad_events_schema_migrations`).Scan(&versions); err != nil || versions != len(sqlMigrations) {
+		t.Errorf("Expected %d recorded migrations, got %d, error %v", len(sqlMigrations), versions, err)
+	}
+}
+
+func TestSQLInsertStatement(t *testing.T) {
+	postgres := sqlInsertStatement(SQLDriverPostgres, "events")
+	want := "INSERT INTO events (time, type, action, cluster, region, namespace, job, node, allocation, task, nomad_index, data, changes) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)"
+	if postgres != want {
+		t.Errorf("sqlInsertStatement() = %q, want %q", postgres, want)
+	}
+}
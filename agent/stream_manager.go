@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+)
+
+// streamTopicEventTypes maps Nomad event stream topics to agent event types
+var streamTopicEventTypes = map[nomadapi.Topic]string{
+	nomadapi.TopicAllocation: EventTypeAllocation,
+	nomadapi.TopicEvaluation: EventTypeEvaluation,
+	nomadapi.TopicNode:       EventTypeNode,
+	nomadapi.TopicJob:        EventTypeJob,
+	nomadapi.TopicDeployment: EventTypeDeployment,
+	nomadapi.TopicNodePool:   "node_pool",
+	nomadapi.TopicService:    "service",
+}
+
+// StreamManager manages events read from the Nomad event stream API
+type StreamManager struct {
+	*BaseManager
+	topics map[nomadapi.Topic][]string
+}
+
+func NewStreamManager(config ManagerConfig, topics map[nomadapi.Topic][]string, index uint64) (*StreamManager, error) {
+	baseManager, err := NewBaseManager(config, EventTypeStream, 0) // No rate limit for the event stream
+	if err != nil {
+		return nil, err
+	}
+
+	// Resume from the requested index
+	baseManager.lastIndex = index
+
+	return &StreamManager{
+		BaseManager: baseManager,
+		topics:      topics,
+	}, nil
+}
+
+func (m *StreamManager) Start(ctx context.Context) error {
+	// A saved checkpoint takes precedence over the configured index
+	m.restoreCheckpoint()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.runStreamWatcher(ctx)
+	}()
+	return nil
+}
+
+func (m *StreamManager) runStreamWatcher(ctx context.Context) {
+	m.runWatcherWithRateLimit(ctx, func(ctx context.Context) error {
+		return m.watchStream(ctx)
+	})
+}
+
+func (m *StreamManager) watchStream(ctx context.Context) error {
+	// Cancel the subscription whenever we return so the stream
+	// goroutine inside the Nomad client is torn down
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Resume after the last index we fully processed
+	index := m.lastIndex
+	if index > 0 {
+		index++
+	}
+
+	eventsCh, err := m.nomadClient.EventStream().Stream(streamCtx, m.topics, index, &nomadapi.QueryOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to open event stream: %w", err)
+	}
+
+	m.logger.Info("Event stream connected",
+		"event_type", m.eventType,
+		"index", index,
+	)
+
+	for {
+		select {
+		case <-m.stopChan:
+			return nil
+		case <-ctx.Done():
+			return nil
+		case events, ok := <-eventsCh:
+			if !ok {
+				return fmt.Errorf("event stream closed")
+			}
+
+			if events.Err != nil {
+				return fmt.Errorf("failed to read event stream: %w", events.Err)
+			}
+
+			// Skip indexes we have already processed before a reconnect
+			if events.Index <= m.lastIndex {
+				continue
+			}
+
+			for i := range events.Events {
+				event := &events.Events[i]
+				nomadEvent := NewStreamEvent(event)
+
+				// Skip events outside of the watched namespaces
+				if nomadEvent.Namespace != "" && !m.watchesNamespace(nomadEvent.Namespace) {
+					continue
+				}
+
+				if err := m.WriteEvent(nomadEvent); err != nil {
+					m.logger.Error("Failed to write stream event",
+						"topic", string(event.Topic),
+						"key", event.Key,
+						"index", event.Index,
+						"error", err.Error(),
+					)
+				}
+			}
+
+			m.lastIndex = events.Index
+			m.saveCheckpoint(Checkpoint{Index: m.lastIndex})
+		}
+	}
+}
+
+// NewStreamEvent converts a Nomad event stream event into an agent event
+func NewStreamEvent(event *nomadapi.Event) *Event {
+	return NewEvent(StreamEventType(event.Topic), event)
+}
+
+// StreamEventType returns the agent event type for a Nomad event stream topic
+func StreamEventType(topic nomadapi.Topic) string {
+	if eventType, ok := streamTopicEventTypes[topic]; ok {
+		return eventType
+	}
+	return strings.ToLower(string(topic))
+}
+
+// ParseStreamTopics parses topic filters in the "Topic" or "Topic:Key" form
+// accepted by the Nomad event stream API
+func ParseStreamTopics(filters []string) (map[nomadapi.Topic][]string, error) {
+	topics := make(map[nomadapi.Topic][]string)
+
+	for _, filter := range filters {
+		topic, key, found := strings.Cut(strings.TrimSpace(filter), ":")
+		if !found {
+			key = "*"
+		}
+
+		if topic == "" || key == "" {
+			return nil, fmt.Errorf("invalid stream topic filter: %q", filter)
+		}
+
+		topics[nomadapi.Topic(topic)] = append(topics[nomadapi.Topic(topic)], key)
+	}
+
+	if len(topics) == 0 {
+		topics[nomadapi.TopicAll] = []string{"*"}
+	}
+
+	return topics, nil
+}
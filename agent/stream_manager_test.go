@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+)
+
+func TestParseStreamTopics(t *testing.T) {
+	tests := []struct {
+		name     string
+		filters  []string
+		expected map[nomadapi.Topic][]string
+		wantErr  bool
+	}{
+		{
+			name:    "no filters subscribes to everything",
+			filters: nil,
+			expected: map[nomadapi.Topic][]string{
+				nomadapi.TopicAll: {"*"},
+			},
+		},
+		{
+			name:    "topic without key",
+			filters: []string{"Job"},
+			expected: map[nomadapi.Topic][]string{
+				nomadapi.TopicJob: {"*"},
+			},
+		},
+		{
+			name:    "multiple keys for one topic",
+			filters: []string{"Job:web", "Job:api", "Node:*"},
+			expected: map[nomadapi.Topic][]string{
+				nomadapi.TopicJob:  {"web", "api"},
+				nomadapi.TopicNode: {"*"},
+			},
+		},
+		{
+			name:    "missing topic",
+			filters: []string{":web"},
+			wantErr: true,
+		},
+		{
+			name:    "missing key",
+			filters: []string{"Job:"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topics, err := ParseStreamTopics(tt.filters)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseStreamTopics() expected error, got %v", topics)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseStreamTopics() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(topics, tt.expected) {
+				t.Errorf("ParseStreamTopics() = %v, want %v", topics, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewStreamEvent(t *testing.T) {
+	streamEvent := &nomadapi.Event{
+		Topic: nomadapi.TopicJob,
+		Type:  "JobRegistered",
+		Key:   "example",
+		Index: 42,
+	}
+
+	event := NewStreamEvent(streamEvent)
+	if event.Type != EventTypeJob {
+		t.Errorf("Expected event type %s, got %s", EventTypeJob, event.Type)
+	}
+
+	if event.Data != streamEvent {
+		t.Errorf("Expected data to be the stream event, got %v", event.Data)
+	}
+
+	if eventType := StreamEventType("ACLToken"); eventType != "acltoken" {
+		t.Errorf("Expected event type acltoken, got %s", eventType)
+	}
+}
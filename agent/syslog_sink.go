@@ -0,0 +1,356 @@
+package agent
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+// Syslog networks
+const (
+	SyslogNetworkUDP  = "udp"
+	SyslogNetworkTCP  = "tcp"
+	SyslogNetworkTLS  = "tcp+tls"
+	SyslogNetworkUnix = "unix"
+)
+
+// DefaultSyslogAppName is the APP-NAME of messages when none is configured
+const DefaultSyslogAppName = "nomad-event-logger"
+
+// Syslog severities (RFC5424 section 6.2.1)
+const (
+	syslogSeverityEmerg = iota
+	syslogSeverityAlert
+	syslogSeverityCrit
+	syslogSeverityErr
+	syslogSeverityWarning
+	syslogSeverityNotice
+	syslogSeverityInfo
+	syslogSeverityDebug
+)
+
+// syslogFacilities maps facility names to their codes
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// syslogStructuredDataID identifies the structured data element carrying the
+// event fields, using the enterprise number reserved for documentation
+const syslogStructuredDataID = "nomad@32473"
+
+// syslogStructuredDataFields are the event fields added as structured data
+var syslogStructuredDataFields = []string{
+	FieldCluster,
+	FieldRegion,
+	FieldNamespace,
+	FieldAction,
+	FieldJob,
+	FieldNode,
+	FieldAllocation,
+	FieldTaskGroup,
+	FieldTask,
+	FieldEvaluation,
+	FieldDeployment,
+}
+
+// SyslogSink sends events as RFC5424 messages
+type SyslogSink struct {
+	config    SyslogConfig
+	tlsConfig *tls.Config
+	facility  int
+	hostname  string
+	procID    string
+	conn      net.Conn
+	transport string
+	mu        sync.Mutex
+}
+
+func NewSyslogSink(config SyslogConfig) (*SyslogSink, error) {
+	facility, ok := syslogFacilities[config.Facility]
+	if config.Facility == "" {
+		facility, ok = syslogFacilities["daemon"], true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown syslog facility: %s", config.Facility)
+	}
+
+	if config.AppName == "" {
+		config.AppName = DefaultSyslogAppName
+	}
+
+	hostname := config.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	s := &SyslogSink{
+		config:   config,
+		facility: facility,
+		hostname: hostname,
+		procID:   strconv.Itoa(os.Getpid()),
+	}
+
+	switch config.Network {
+	case SyslogNetworkUDP, SyslogNetworkTCP, SyslogNetworkUnix:
+	case SyslogNetworkTLS:
+		tlsConfig := config.TLS
+		tlsConfig.Enabled = true
+
+		var err error
+		if s.tlsConfig, err = newClientTLSConfig(tlsConfig); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown syslog network: %s", config.Network)
+	}
+
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// connect dials the syslog server
+func (s *SyslogSink) connect() error {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	var conn net.Conn
+	var err error
+	transport := s.config.Network
+	switch s.config.Network {
+	case SyslogNetworkTLS:
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.config.Address, s.tlsConfig)
+	case SyslogNetworkUnix:
+		// Local syslog daemons listen on either a datagram or a stream socket
+		transport = "unixgram"
+		conn, err = dialer.Dial(transport, s.config.Address)
+		if err != nil {
+			transport = "unix"
+			conn, err = dialer.Dial(transport, s.config.Address)
+		}
+	default:
+		conn, err = dialer.Dial(s.config.Network, s.config.Address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog %s: %w", s.config.Address, err)
+	}
+
+	s.conn = conn
+	s.transport = transport
+	return nil
+}
+
+func (s *SyslogSink) Write(event *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	message, err := s.format(event)
+	if err != nil {
+		return err
+	}
+
+	// Reconnect once when the connection was closed by the server
+	if err := s.send(message); err != nil {
+		if s.conn != nil {
+			s.conn.Close()
+			s.conn = nil
+		}
+		if err := s.connect(); err != nil {
+			return err
+		}
+		if err := s.send(message); err != nil {
+			return fmt.Errorf("failed to write to syslog: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// send writes the message with the framing required by the transport
+func (s *SyslogSink) send(message []byte) error {
+	if s.conn == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	switch s.transport {
+	case "udp", "unixgram":
+		// One message per datagram
+	case "unix":
+		// Local stream sockets delimit messages by newlines
+		message = append(message, '\n')
+	default:
+		// Octet counting framing (RFC6587 and RFC5425)
+		message = append([]byte(strconv.Itoa(len(message))+" "), message...)
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := s.conn.Write(message)
+	return err
+}
+
+// format builds the RFC5424 message for the event, carrying the event JSON
+// as the message body
+func (s *SyslogSink) format(event *Event) ([]byte, error) {
+	data, err := event.ToJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s %s ",
+		s.facility*8+syslogSeverity(event),
+		event.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderField(s.hostname, 255),
+		syslogHeaderField(s.config.AppName, 48),
+		syslogHeaderField(s.procID, 128),
+		syslogHeaderField(event.Type, 32),
+	)
+	b.WriteString(syslogStructuredData(event))
+	b.WriteByte(' ')
+	b.Write(data)
+
+	return []byte(b.String()), nil
+}
+
+// syslogHeaderField returns the value as a header field, which must be
+// printable ASCII without spaces, using the nil value "-" when empty
+func syslogHeaderField(value string, maxLength int) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, value)
+
+	if value == "" {
+		return "-"
+	}
+	if len(value) > maxLength {
+		return value[:maxLength]
+	}
+	return value
+}
+
+// syslogStructuredData returns the structured data element holding the
+// event fields that are set
+func syslogStructuredData(event *Event) string {
+	var b strings.Builder
+	for _, field := range syslogStructuredDataFields {
+		value := event.Field(field)
+		if value == "" {
+			continue
+		}
+
+		// Param values escape '"', '\' and ']'
+		value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+		fmt.Fprintf(&b, ` %s="%s"`, field, value)
+	}
+
+	if b.Len() == 0 {
+		return "-"
+	}
+	return "[" + syslogStructuredDataID + b.String() + "]"
+}
+
+// syslogSeverity maps the event type and outcome to a severity
+func syslogSeverity(event *Event) int {
+	if event.Action == ActionDeleted {
+		return syslogSeverityNotice
+	}
+
+	switch data := event.Data.(type) {
+	case *TaskEvent:
+		if data.TaskEvent == nil {
+			break
+		}
+		switch {
+		case data.TaskEvent.FailsTask,
+			data.TaskEvent.Type == api.TaskTerminated && data.TaskEvent.ExitCode != 0,
+			data.TaskEvent.Type == api.TaskDriverFailure,
+			data.TaskEvent.Type == api.TaskSetupFailure,
+			data.TaskEvent.Type == api.TaskFailedValidation,
+			data.TaskEvent.Type == api.TaskArtifactDownloadFailed,
+			data.TaskEvent.Type == api.TaskNotRestarting:
+			return syslogSeverityErr
+		case data.TaskEvent.Type == api.TaskRestarting,
+			data.TaskEvent.Type == api.TaskKilling,
+			data.TaskEvent.Type == api.TaskKilled,
+			data.TaskEvent.Type == api.TaskSignaling:
+			return syslogSeverityWarning
+		}
+	case *AllocationEvent:
+		if data.Current == nil {
+			break
+		}
+		switch data.Current.ClientStatus {
+		case api.AllocClientStatusFailed:
+			return syslogSeverityErr
+		case api.AllocClientStatusLost:
+			return syslogSeverityWarning
+		}
+	case *api.Deployment:
+		switch data.Status {
+		case api.DeploymentStatusFailed:
+			return syslogSeverityErr
+		case api.DeploymentStatusCancelled:
+			return syslogSeverityWarning
+		case api.DeploymentStatusSuccessful:
+			return syslogSeverityNotice
+		}
+	case *api.Evaluation:
+		switch data.Status {
+		case api.EvalStatusFailed:
+			return syslogSeverityErr
+		case api.EvalStatusBlocked:
+			return syslogSeverityWarning
+		}
+	case *api.NodeListStub:
+		switch data.Status {
+		case api.NodeStatusDown:
+			return syslogSeverityErr
+		case api.NodeStatusDisconnected:
+			return syslogSeverityWarning
+		}
+	}
+
+	return syslogSeverityInfo
+}
+
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil {
+		err := s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package agent
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+)
+
+func TestSyslogSeverity(t *testing.T) {
+	tests := []struct {
+		name  string
+		event *Event
+		want  int
+	}{
+		{
+			name:  "task terminated with non-zero exit code",
+			event: NewEvent(EventTypeTask, &TaskEvent{TaskEvent: &api.TaskEvent{Type: api.TaskTerminated, ExitCode: 137}}),
+			want:  syslogSeverityErr,
+		},
+		{
+			name:  "task terminated successfully",
+			event: NewEvent(EventTypeTask, &TaskEvent{TaskEvent: &api.TaskEvent{Type: api.TaskTerminated}}),
+			want:  syslogSeverityInfo,
+		},
+		{
+			name:  "task restarting",
+			event: NewEvent(EventTypeTask, &TaskEvent{TaskEvent: &api.TaskEvent{Type: api.TaskRestarting}}),
+			want:  syslogSeverityWarning,
+		},
+		{
+			name:  "failed allocation",
+			event: NewEvent(EventTypeAllocation, &AllocationEvent{Current: &AllocationState{ClientStatus: api.AllocClientStatusFailed}}),
+			want:  syslogSeverityErr,
+		},
+		{
+			name:  "successful deployment",
+			event: NewEvent(EventTypeDeployment, &api.Deployment{Status: api.DeploymentStatusSuccessful}),
+			want:  syslogSeverityNotice,
+		},
+		{
+			name:  "node down",
+			event: NewEvent(EventTypeNode, &api.NodeListStub{Status: api.NodeStatusDown}),
+			want:  syslogSeverityErr,
+		},
+		{
+			name:  "running job",
+			event: NewEvent(EventTypeJob, &api.JobListStub{Status: "running"}),
+			want:  syslogSeverityInfo,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := syslogSeverity(tt.event); got != tt.want {
+				t.Errorf("syslogSeverity() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// rfc5424Pattern matches the header and structured data of an RFC5424 message
+var rfc5424Pattern = regexp.MustCompile(`^<(\d+)>1 (\S+) (\S+) (\S+) (\d+) (\S+) (\[.*?[^\\]\]|-) (\{.*\})$`)
+
+func TestSyslogSink_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	sink, err := NewSyslogSink(SyslogConfig{
+		Network:  SyslogNetworkUDP,
+		Address:  conn.LocalAddr().String(),
+		Facility: "local0",
+		Hostname: "agent-1",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create syslog sink: %v", err)
+	}
+	defer sink.Close()
+
+	event := NewEvent(EventTypeTask, &TaskEvent{
+		Namespace: "default",
+		JobID:     `web"app`,
+		TaskName:  "nginx",
+		TaskEvent: &api.TaskEvent{Type: api.TaskTerminated, ExitCode: 1},
+	})
+	if err := sink.Write(event); err != nil {
+		t.Fatalf("SyslogSink.Write() error = %v", err)
+	}
+
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+
+	match := rfc5424Pattern.FindStringSubmatch(string(buf[:n]))
+	if match == nil {
+		t.Fatalf("Message is not RFC5424: %s", buf[:n])
+	}
+
+	// local0 (16) * 8 + err (3)
+	if match[1] != "131" {
+		t.Errorf("Expected priority 131, got %s", match[1])
+	}
+	if match[3] != "agent-1" || match[4] != DefaultSyslogAppName || match[6] != EventTypeTask {
+		t.Errorf("Unexpected header fields: %v", match[3:7])
+	}
+	if !strings.Contains(match[7], `job="web\"app"`) || !strings.Contains(match[7], `task="nginx"`) {
+		t.Errorf("Unexpected structured data: %s", match[7])
+	}
+}
+
+func TestSyslogSink_TCPFraming(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	messages := make(chan string, 2)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		for {
+			length, err := reader.ReadString(' ')
+			if err != nil {
+				return
+			}
+			size, _ := strconv.Atoi(strings.TrimSpace(length))
+			message := make([]byte, size)
+			if _, err := io.ReadFull(reader, message); err != nil {
+				return
+			}
+			messages <- string(message)
+		}
+	}()
+
+	sink, err := NewSyslogSink(SyslogConfig{Network: SyslogNetworkTCP, Address: listener.Addr().String()})
+	if err != nil {
+		t.Fatalf("Failed to create syslog sink: %v", err)
+	}
+	defer sink.Close()
+
+	for _, job := range []string{"web", "api"} {
+		if err := sink.Write(NewEvent(EventTypeJob, &api.JobListStub{ID: job})); err != nil {
+			t.Fatalf("SyslogSink.Write() error = %v", err)
+		}
+	}
+
+	for _, job := range []string{"web", "api"} {
+		select {
+		case message := <-messages:
+			if !rfc5424Pattern.MatchString(message) || !strings.Contains(message, `job="`+job+`"`) {
+				t.Errorf("Unexpected message: %s", message)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for message")
+		}
+	}
+}
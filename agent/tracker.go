@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"sort"
+)
+
+// objectTracker remembers the objects returned by a manager's last List call
+// so objects that drop out of a later response can be reported as deleted
+type objectTracker[T any] struct {
+	objects map[string]T
+
+	// restored holds the IDs saved with a checkpoint until the first Sync,
+	// with a stub standing in for the object
+	restored map[string]T
+
+	// ids caches the sorted IDs of the tracked objects
+	ids []string
+}
+
+func newObjectTracker[T any]() *objectTracker[T] {
+	return &objectTracker[T]{
+		objects: make(map[string]T),
+	}
+}
+
+// Get returns the last known version of an object
+func (t *objectTracker[T]) Get(id string) (T, bool) {
+	object, ok := t.objects[id]
+	return object, ok
+}
+
+// Restore tracks the IDs saved with a checkpoint, so objects purged while
+// the agent was down are reported as deleted by the next Sync. stub builds
+// the object carried by their deleted events.
+func (t *objectTracker[T]) Restore(ids []string, stub func(id string) T) {
+	t.restored = make(map[string]T, len(ids))
+	for _, id := range ids {
+		t.restored[id] = stub(id)
+	}
+}
+
+// IDs returns the IDs of the tracked objects in order, to be saved with the
+// checkpoint
+func (t *objectTracker[T]) IDs() []string {
+	if t.ids == nil {
+		t.ids = make([]string, 0, len(t.objects))
+		for id := range t.objects {
+			t.ids = append(t.ids, id)
+		}
+		sort.Strings(t.ids)
+	}
+	return t.ids
+}
+
+// Sync replaces the tracked objects with the current set and returns the
+// last known version of every object that is no longer present, ordered by ID
+func (t *objectTracker[T]) Sync(current map[string]T) []T {
+	previous := t.objects
+	for id, stub := range t.restored {
+		if _, ok := previous[id]; !ok {
+			previous[id] = stub
+		}
+	}
+	t.restored = nil
+
+	var removedIDs []string
+	for id := range previous {
+		if _, ok := current[id]; !ok {
+			removedIDs = append(removedIDs, id)
+		}
+	}
+	sort.Strings(removedIDs)
+
+	removed := make([]T, 0, len(removedIDs))
+	for _, id := range removedIDs {
+		removed = append(removed, previous[id])
+	}
+
+	// The cached IDs stay valid when no object was added or removed
+	if len(removedIDs) > 0 || len(current) != len(previous) {
+		t.ids = nil
+	}
+
+	t.objects = current
+	return removed
+}
+
+// namespacedID builds a tracker ID that is unique across namespaces
+func namespacedID(namespace, id string) string {
+	return namespace + "/" + id
+}
+
+// writeDeletedEvents writes a deleted event for every object that has
+// disappeared, carrying its last known version and the index it was noticed at
+func writeDeletedEvents[T any](m *BaseManager, objects []T, index uint64) {
+	for _, object := range objects {
+		nomadEvent := NewEvent(m.eventType, object)
+		nomadEvent.Action = ActionDeleted
+		nomadEvent.Index = index
+
+		if err := m.WriteEvent(nomadEvent); err != nil {
+			m.logger.Error("Failed to write deleted event",
+				"event_type", m.eventType,
+				"error", err.Error(),
+			)
+		}
+	}
+}
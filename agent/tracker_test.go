@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestObjectTracker_Sync(t *testing.T) {
+	tracker := newObjectTracker[string]()
+
+	if removed := tracker.Sync(map[string]string{"a": "a1", "b": "b1", "c": "c1"}); len(removed) != 0 {
+		t.Errorf("Expected no removed objects on first sync, got %v", removed)
+	}
+
+	removed := tracker.Sync(map[string]string{"b": "b2"})
+	if !reflect.DeepEqual(removed, []string{"a1", "c1"}) {
+		t.Errorf("Expected removed objects [a1 c1], got %v", removed)
+	}
+
+	if object, ok := tracker.Get("b"); !ok || object != "b2" {
+		t.Errorf("Expected tracked object b2, got %v (found %v)", object, ok)
+	}
+
+	if _, ok := tracker.Get("a"); ok {
+		t.Error("Expected removed object to no longer be tracked")
+	}
+}
+
+func TestObjectTracker_Restore(t *testing.T) {
+	tracker := newObjectTracker[string]()
+	tracker.Sync(map[string]string{"a": "a1", "b": "b1"})
+
+	ids := tracker.IDs()
+	if !reflect.DeepEqual(ids, []string{"a", "b"}) {
+		t.Fatalf("Expected IDs [a b], got %v", ids)
+	}
+
+	// A restarted tracker reports objects purged while the agent was down
+	restarted := newObjectTracker[string]()
+	restarted.Restore(ids, func(id string) string { return id + "-stub" })
+
+	if _, ok := restarted.Get("a"); ok {
+		t.Error("Expected restored objects not to be known versions")
+	}
+
+	removed := restarted.Sync(map[string]string{"b": "b2", "c": "c1"})
+	if !reflect.DeepEqual(removed, []string{"a-stub"}) {
+		t.Errorf("Expected removed objects [a-stub], got %v", removed)
+	}
+
+	if ids := restarted.IDs(); !reflect.DeepEqual(ids, []string{"b", "c"}) {
+		t.Errorf("Expected IDs [b c], got %v", ids)
+	}
+
+	// Restored IDs are only reported once
+	if removed := restarted.Sync(map[string]string{"b": "b2", "c": "c1"}); len(removed) != 0 {
+		t.Errorf("Expected no removed objects, got %v", removed)
+	}
+}
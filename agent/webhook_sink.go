@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// DefaultWebhookSignatureHeader is the header carrying the body signature
+const DefaultWebhookSignatureHeader = "X-Signature-256"
+
+// WebhookSink POSTs batches of events as a JSON array to a URL
+type WebhookSink struct {
+	config  WebhookConfig
+	client  *http.Client
+	batcher *eventBatcher
+}
+
+func NewWebhookSink(config WebhookConfig) (*WebhookSink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("webhook url is required")
+	}
+
+	if config.SignatureHeader == "" {
+		config.SignatureHeader = DefaultWebhookSignatureHeader
+	}
+
+	s := &WebhookSink{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}
+	s.batcher = newEventBatcher("webhook", config.Batch, s.send)
+
+	return s, nil
+}
+
+func (s *WebhookSink) Write(event *Event) error {
+	return s.batcher.Add(event)
+}
+
+func (s *WebhookSink) Accepted() uint64 {
+	return s.batcher.Accepted()
+}
+
+func (s *WebhookSink) Delivered() uint64 {
+	return s.batcher.Delivered()
+}
+
+func (s *WebhookSink) Close() error {
+	return s.batcher.Close()
+}
+
+// send delivers a batch of events, retrying transient failures
+func (s *WebhookSink) send(events []*Event) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("failed to marshal events: %w", err)
+	}
+
+	err = withRetry(s.config.Retry, func() error {
+		req, err := http.NewRequest(http.MethodPost, s.config.URL, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		for name, value := range s.config.Headers {
+			req.Header.Set(name, value)
+		}
+		if s.config.Secret != "" {
+			req.Header.Set(s.config.SignatureHeader, signWebhookBody(s.config.Secret, body))
+		}
+
+		resp, err := doHTTPRequest(s.client, req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to deliver %d events to webhook: %w", len(events), err)
+	}
+
+	return nil
+}
+
+// signWebhookBody returns the hex encoded HMAC-SHA256 of the body, prefixed
+// with the algorithm name
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookSink(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]Event
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Expected Authorization header, got %q", got)
+		}
+		if got, want := r.Header.Get(DefaultWebhookSignatureHeader), signWebhookBody("secret", body); got != want {
+			t.Errorf("Expected signature %q, got %q", want, got)
+		}
+
+		var events []Event
+		if err := json.Unmarshal(body, &events); err != nil {
+			t.Errorf("Failed to decode batch: %v", err)
+		}
+
+		mu.Lock()
+		batches = append(batches, events)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhookSink(WebhookConfig{
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer token"},
+		Secret:  "secret",
+		Batch:   BatchConfig{Size: 2},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create webhook sink: %v", err)
+	}
+
+	for _, eventType := range []string{EventTypeJob, EventTypeNode, EventTypeDeployment} {
+		if err := sink.Write(NewEvent(eventType, map[string]string{"id": "1"})); err != nil {
+			t.Fatalf("WebhookSink.Write() error = %v", err)
+		}
+	}
+
+	// The third event is only sent when the sink is closed
+	waitForDelivered(t, sink, 2)
+	mu.Lock()
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Errorf("Expected one batch of 2 events before close, got %v", batches)
+	}
+	mu.Unlock()
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("WebhookSink.Close() error = %v", err)
+	}
+
+	if len(batches) != 2 || len(batches[1]) != 1 || batches[1][0].Type != EventTypeDeployment {
+		t.Errorf("Expected the remaining event to be flushed on close, got %v", batches)
+	}
+}
+
+func TestWebhookSink_Retry(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{
+			name:         "retries server errors",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			wantAttempts: 3,
+		},
+		{
+			name:         "gives up after max retries",
+			statuses:     []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			wantAttempts: 3,
+			wantErr:      true,
+		},
+		{
+			name:         "does not retry client errors",
+			statuses:     []int{http.StatusBadRequest, http.StatusOK},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Closing the sink sends a failed batch again
+				w.WriteHeader(tt.statuses[min(attempts, len(tt.statuses)-1)])
+				attempts++
+			}))
+			defer server.Close()
+
+			sink, err := NewWebhookSink(WebhookConfig{
+				URL: server.URL,
+				Retry: RetryConfig{
+					MaxRetries:     2,
+					InitialBackoff: time.Millisecond,
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to create webhook sink: %v", err)
+			}
+			defer sink.Close()
+
+			err = sink.send([]*Event{NewEvent(EventTypeJob, map[string]string{"id": "1"})})
+			if tt.wantErr && err == nil {
+				t.Error("WebhookSink.send() expected error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("WebhookSink.send() error = %v", err)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("Expected %d attempts, got %d", tt.wantAttempts, attempts)
+			}
+		})
+	}
+}
+
+func TestWebhookSink_KeepsFailedBatches(t *testing.T) {
+	var received []int
+	var failing atomic.Bool
+	var attempts atomic.Int64
+	failing.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var events []Event
+		json.NewDecoder(r.Body).Decode(&events)
+		received = append(received, len(events))
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhookSink(WebhookConfig{
+		URL:   server.URL,
+		Batch: BatchConfig{Size: 2},
+		Retry: RetryConfig{InitialBackoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create webhook sink: %v", err)
+	}
+
+	for _, id := range []string{"1", "2"} {
+		sink.Write(NewEvent(EventTypeJob, map[string]string{"id": id}))
+	}
+	for attempts.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if sink.Accepted() != 2 || sink.Delivered() != 0 {
+		t.Fatalf("Expected 2 accepted and 0 delivered events, got %d and %d", sink.Accepted(), sink.Delivered())
+	}
+
+	// The failed batch is sent again before the next one
+	failing.Store(false)
+	for _, id := range []string{"3", "4"} {
+		if err := sink.Write(NewEvent(EventTypeJob, map[string]string{"id": id})); err != nil {
+			t.Fatalf("WebhookSink.Write() error = %v", err)
+		}
+	}
+	waitForDelivered(t, sink, 4)
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("WebhookSink.Close() error = %v", err)
+	}
+	if !reflect.DeepEqual(received, []int{2, 2}) {
+		t.Errorf("Expected two batches of 2 events, got %v", received)
+	}
+}
+
+func TestWebhookSink_BatchInterval(t *testing.T) {
+	received := make(chan int, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var events []Event
+		json.NewDecoder(r.Body).Decode(&events)
+		received <- len(events)
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhookSink(WebhookConfig{
+		URL:   server.URL,
+		Batch: BatchConfig{Size: 100, Interval: 10 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create webhook sink: %v", err)
+	}
+	defer sink.Close()
+
+	if err := sink.Write(NewEvent(EventTypeJob, map[string]string{"id": "1"})); err != nil {
+		t.Fatalf("WebhookSink.Write() error = %v", err)
+	}
+
+	select {
+	case count := <-received:
+		if count != 1 {
+			t.Errorf("Expected a batch of 1 event, got %d", count)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the batch to be sent after the interval")
+	}
+}